@@ -0,0 +1,173 @@
+package gemtext
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// blockAttributes finds the attribute lists, such as "{#id .class}", written
+// at the end of blocks in a document. It returns the attributes of each block
+// they belong to, where each list starts in the source keyed by the block it's
+// written in so it can be left out, and the nodes holding nothing but a list.
+//
+// A list at the end of a heading belongs to the heading. A list on the last
+// line of a paragraph belongs to the paragraph, unless it's a lazy
+// continuation line, in which case it belongs to the outermost block the
+// paragraph ends, such as a blockquote or list. A paragraph holding only a
+// list belongs to the block directly before it, without a blank line between
+// them, and a table's last row holding only a list belongs to the table.
+func blockAttributes(source []byte, doc ast.Node) (map[ast.Node]parser.Attributes, map[ast.Node]int, map[ast.Node]bool) {
+	attrs := map[ast.Node]parser.Attributes{}
+	starts := map[ast.Node]int{}
+	lists := map[ast.Node]bool{}
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		switch node.Kind() {
+		case ast.KindHeading, ast.KindParagraph, ast.KindTextBlock:
+		case east.KindTable:
+			if row, list, ok := tableAttributes(source, node); ok {
+				attrs[node] = append(attrs[node], list...)
+				lists[row] = true
+			}
+			return ast.WalkSkipChildren, nil
+		default:
+			return ast.WalkContinue, nil
+		}
+		lines := node.Lines()
+		if lines.Len() == 0 {
+			return ast.WalkSkipChildren, nil
+		}
+		line := lines.At(lines.Len() - 1)
+		value := bytes.TrimRight(line.Value(source), " \t\r\n")
+
+		target := node
+		var i int
+		if node.Kind() == ast.KindHeading {
+			i = bytes.LastIndexByte(value, '{')
+			if i <= 0 || value[i-1] != ' ' && value[i-1] != '\t' {
+				return ast.WalkSkipChildren, nil
+			}
+		} else {
+			i = len(value) - len(bytes.TrimLeft(value, " \t"))
+			if i == len(value) || value[i] != '{' {
+				return ast.WalkSkipChildren, nil
+			}
+		}
+		list, ok := attributeList(value[i:])
+		if !ok {
+			return ast.WalkSkipChildren, nil
+		}
+
+		start := line.Start + len(bytes.TrimRight(value[:i], " \t"))
+		switch {
+		case node.Kind() == ast.KindHeading:
+		case lines.Len() > 1:
+			prev := lines.At(lines.Len() - 2)
+			start = prev.Start + len(bytes.TrimRight(prev.Value(source), " \t\r\n"))
+			if lazyLine(source, line.Start) {
+				for p := target.Parent(); p != nil && p.Kind() != ast.KindDocument && p.LastChild() == target; p = p.Parent() {
+					target = p
+				}
+			}
+		default:
+			target = node.PreviousSibling()
+			if target == nil || node.HasBlankPreviousLines() {
+				return ast.WalkSkipChildren, nil
+			}
+			lists[node] = true
+		}
+		attrs[target] = append(attrs[target], list...)
+		starts[node] = start
+		return ast.WalkSkipChildren, nil
+	})
+	return attrs, starts, lists
+}
+
+// tableAttributes returns the last row of a table and its attribute list if
+// the row holds nothing else. A line right after a table is read as a row, so
+// that's where the table's attributes are written.
+func tableAttributes(source []byte, table ast.Node) (ast.Node, parser.Attributes, bool) {
+	row := table.LastChild()
+	if row == nil || row.Kind() != east.KindTableRow {
+		return nil, nil, false
+	}
+	var list parser.Attributes
+	for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+		value := bytes.TrimSpace(cell.Text(source))
+		switch {
+		case len(value) == 0:
+		case cell == row.FirstChild():
+			var ok bool
+			if list, ok = attributeList(value); !ok {
+				return nil, nil, false
+			}
+		default:
+			return nil, nil, false
+		}
+	}
+	return row, list, list != nil
+}
+
+// attributeList parses s as a single attribute list or returns false if it's
+// anything else.
+func attributeList(s []byte) (parser.Attributes, bool) {
+	reader := text.NewReader(s)
+	attrs, ok := parser.ParseAttributes(reader)
+	if !ok {
+		return nil, false
+	}
+	rest, _ := reader.PeekLine()
+	if len(bytes.TrimSpace(rest)) > 0 {
+		return nil, false
+	}
+	return attrs, true
+}
+
+// lazyLine returns true if the source line containing pos has nothing but
+// spaces before pos, such as a paragraph continuation line without the
+// markers of the blockquote it's in.
+func lazyLine(source []byte, pos int) bool {
+	for i := pos - 1; i >= 0 && source[i] != '\n'; i-- {
+		if source[i] != ' ' && source[i] != '\t' {
+			return false
+		}
+	}
+	return true
+}
+
+// attribute returns the value of an attribute of a node. Attributes set by the
+// parser are used first, followed by attribute lists found by blockAttributes.
+func (r *GemRenderer) attribute(node ast.Node, name string) (string, bool) {
+	value, ok := node.AttributeString(name)
+	if !ok {
+		value, ok = r.attributes[node].Find([]byte(name))
+	}
+	if !ok {
+		return "", false
+	}
+	if b, ok := value.([]byte); ok {
+		return string(b), true
+	}
+	return fmt.Sprint(value), true
+}
+
+// textValue returns the part of a text node which is printed. Attribute lists
+// are left out, along with any space or line break before them. The returned
+// bool is true if nothing else in the block is printed after the text.
+func (r *GemRenderer) textValue(source []byte, n *ast.Text) ([]byte, bool) {
+	start, ok := r.attributeStarts[n.Parent()]
+	if !ok || n.Segment.Stop < start {
+		return n.Segment.Value(source), false
+	}
+	if n.Segment.Start >= start {
+		return nil, true
+	}
+	return source[n.Segment.Start:start], true
+}
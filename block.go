@@ -3,26 +3,52 @@ package gemtext
 import (
 	"bytes"
 	"fmt"
+	"io"
+	"strings"
 
+	"git.sr.ht/~kota/fuckery"
 	wast "git.sr.ht/~kota/goldmark-wiki/ast"
 	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
 	"github.com/yuin/goldmark/util"
 )
 
 func (r *GemRenderer) renderDocument(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
-	// Nothing to do.
+	n := node.(*ast.Document)
+	if entering {
+		r.reset()
+		r.prepare(source, n)
+	} else {
+		// End the last heading section, unless the footnote list already
+		// did.
+		last := n.LastChild()
+		if last == nil || last.Kind() != east.KindFootnoteList {
+			if err := r.sectionEnd(w, source, last); err != nil {
+				return ast.WalkStop, err
+			}
+		}
+	}
 	return ast.WalkContinue, nil
 }
 
 func (r *GemRenderer) renderHeading(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
 	n := node.(*ast.Heading)
 	if entering {
+		// Headings in the document's root begin a new section.
+		if n.Parent() != nil && n.Parent().Kind() == ast.KindDocument {
+			if err := r.sectionEnd(w, source, n.PreviousSibling()); err != nil {
+				return ast.WalkStop, err
+			}
+		}
+
 		// Check if the heading contains only links.
 		if r.config.HeadingLink == HeadingLinkAuto {
 			if linkOnly(source, n) {
 				// In Auto mode, link only headings prints their first link then exit.
 				for child := n.FirstChild(); child != nil; child = child.NextSibling() {
-					if linkPrint(w, source, child, r.config.LinkReplacers, "") {
+					if r.linkPrint(w, source, child, "") {
 						return ast.WalkSkipChildren, nil
 					}
 				}
@@ -30,14 +56,16 @@ func (r *GemRenderer) renderHeading(w util.BufWriter, source []byte, node ast.No
 		}
 
 		// Print the heading. Automode link only headings wont make it this far.
-		switch n.Level {
-		case 1:
-			fmt.Fprintf(w, "# ")
-		case 2:
-			fmt.Fprintf(w, "## ")
-		default:
-			fmt.Fprintf(w, "### ")
+		marker, ok := r.headingMarker(n.Level)
+		if !ok {
+			text, err := r.inlineText(source, n)
+			if err != nil {
+				return ast.WalkStop, err
+			}
+			fmt.Fprintf(w, "%s", fuckery.BoldSans(string(text)))
+			return ast.WalkSkipChildren, nil
 		}
+		fmt.Fprintf(w, "%s", marker)
 
 		if r.config.HeadingLink == HeadingLinkOff || r.config.HeadingLink == HeadingLinkBelow {
 			// Check if it's link only to print the link labels. Link labels
@@ -56,17 +84,12 @@ func (r *GemRenderer) renderHeading(w util.BufWriter, source []byte, node ast.No
 			}
 		}
 	} else {
-
-		if r.config.HeadingSpace == HeadingSpaceSingle {
-			fmt.Fprintf(w, "\n")
-		} else {
-			fmt.Fprintf(w, "\n\n")
-		}
+		r.headingEnd(w)
 		if r.config.HeadingLink == HeadingLinkBelow {
 			// Print all links that were in the heading below the heading.
 			var hasLink bool
 			for child := n.FirstChild(); child != nil; child = child.NextSibling() {
-				if linkPrint(w, source, child, r.config.LinkReplacers, "") {
+				if r.linkPrint(w, source, child, "") {
 					fmt.Fprint(w, "\n")
 					hasLink = true
 				}
@@ -77,17 +100,55 @@ func (r *GemRenderer) renderHeading(w util.BufWriter, source []byte, node ast.No
 				fmt.Fprintf(w, "\n")
 			}
 		}
+
+		// The table of contents follows the document's first heading.
+		if r.config.TOC != TOCOff && !r.tocPrinted && n.Parent() != nil && n.Parent().Kind() == ast.KindDocument {
+			r.tocPrinted = true
+			if err := r.tocPrint(w, source, n); err != nil {
+				return ast.WalkStop, err
+			}
+		}
 	}
 	return ast.WalkContinue, nil
 }
 
+// headingEnd ends the line of a heading, followed by a blank line unless the
+// HeadingSpace config option is set to single.
+func (r *GemRenderer) headingEnd(w io.Writer) {
+	if r.config.HeadingSpace == HeadingSpaceSingle {
+		fmt.Fprintf(w, "\n")
+	} else {
+		fmt.Fprintf(w, "\n\n")
+	}
+}
+
+// headingMarker returns the start of the line printed for a heading of the
+// given level, based on the HeadingLevel config option. It returns false if
+// the heading's text is printed in bold unicode instead.
+func (r *GemRenderer) headingMarker(level int) (string, bool) {
+	if r.config.HeadingLevel == HeadingLevelOffset {
+		level -= r.config.HeadingOffset
+	}
+	switch {
+	case level <= 1:
+		return "# ", true
+	case level == 2:
+		return "## ", true
+	case r.config.HeadingLevel == HeadingLevelText && level > 3:
+		return r.config.HeadingMarker, true
+	case r.config.HeadingLevel == HeadingLevelUnicode && level > 3:
+		return "", false
+	default:
+		return "### ", true
+	}
+}
+
 func (r *GemRenderer) renderBlockquote(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
 	n := node.(*ast.Blockquote)
 	if entering {
 		var buf bytes.Buffer
 		for child := n.FirstChild(); child != nil; child = child.NextSibling() {
-			sub := New()
-			if err := sub.Render(&buf, source, child); err != nil {
+			if err := r.render(&buf, source, child); err != nil {
 				return ast.WalkStop, err
 			}
 		}
@@ -114,13 +175,8 @@ func (r *GemRenderer) renderCodeBlock(w util.BufWriter, source []byte, node ast.
 	// info line.
 	n := node.(*ast.CodeBlock)
 	if entering {
-		fmt.Fprintf(w, "```")
-		fmt.Fprintf(w, "\n")
-		lines := n.Lines()
-		for i := 0; i < lines.Len(); i++ {
-			line := lines.At(i)
-			fmt.Fprintf(w, "%s", line.Value(source))
-		}
+		fmt.Fprintf(w, "```%s\n", r.codeBlockAlt(source, n))
+		r.codeLinesPrint(w, source, n.Lines())
 
 		fmt.Fprintf(w, "```")
 		return ast.WalkSkipChildren, nil
@@ -132,18 +188,20 @@ func (r *GemRenderer) renderCodeBlock(w util.BufWriter, source []byte, node ast.
 
 func (r *GemRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
 	n := node.(*ast.FencedCodeBlock)
-	if entering {
-		fmt.Fprintf(w, "```")
-		if n.Info != nil {
-			fmt.Fprintf(w, "%s", n.Info.Segment.Value(source))
+	// Code blocks with a handler for their language are written by it
+	// instead. A nil handler leaves the code block preformatted.
+	if handler := r.config.CodeBlockHandlers[codeBlockLanguage(source, n)]; handler != nil {
+		if entering {
+			if _, err := r.codeBlockHandle(w, source, n); err != nil {
+				return ast.WalkStop, err
+			}
 		}
-		fmt.Fprintf(w, "\n")
+		return ast.WalkSkipChildren, nil
+	}
+	if entering {
+		fmt.Fprintf(w, "```%s\n", r.codeBlockAlt(source, n))
 
-		lines := n.Lines()
-		for i := 0; i < lines.Len(); i++ {
-			line := lines.At(i)
-			fmt.Fprintf(w, "%s", line.Value(source))
-		}
+		r.codeLinesPrint(w, source, n.Lines())
 
 		fmt.Fprintf(w, "```")
 		return ast.WalkSkipChildren, nil
@@ -153,8 +211,108 @@ func (r *GemRenderer) renderFencedCodeBlock(w util.BufWriter, source []byte, nod
 	return ast.WalkContinue, nil
 }
 
+// codeBlockAlt is a helper function that returns the alt text of a code block
+// based on the CodeBlockAlt config option. Code blocks without alt text, such
+// as indented code blocks, use the CodeBlockAltDefault config option. An alt
+// attribute on the code block is always used instead.
+func (r *GemRenderer) codeBlockAlt(source []byte, node ast.Node) string {
+	if alt, ok := r.attribute(node, "alt"); ok {
+		return alt
+	}
+	n, ok := node.(*ast.FencedCodeBlock)
+	if !ok || n.Info == nil {
+		return r.config.CodeBlockAltDefault
+	}
+	info := n.Info.Segment.Value(source)
+	language := codeBlockLanguage(source, n)
+
+	var alt string
+	switch r.config.CodeBlockAlt {
+	case CodeBlockAltLanguage:
+		alt = language
+	case CodeBlockAltDescription:
+		alt = language
+		if description, ok := r.config.CodeBlockDescriptions[language]; ok {
+			alt = description
+		}
+	case CodeBlockAltAttribute:
+		alt = language
+		if i := bytes.IndexByte(info, '{'); i >= 0 {
+			attrs, _ := parser.ParseAttributes(text.NewReader(info[i:]))
+			for _, name := range []string{"title", "alt"} {
+				if value, ok := attrs.Find([]byte(name)); ok {
+					if b, ok := value.([]byte); ok {
+						alt = string(b)
+						break
+					}
+				}
+			}
+		}
+	default:
+		alt = string(info)
+	}
+	if alt == "" {
+		return r.config.CodeBlockAltDefault
+	}
+	return alt
+}
+
+// codeLinesPrint is a helper function that prints the lines of a code block.
+// Lines which begin with a preformatting toggle would end the preformatted
+// text early, so they're rewritten based on the CodeFence config option and a
+// warning is sent to the Warn config option.
+func (r *GemRenderer) codeLinesPrint(w util.BufWriter, source []byte, lines *text.Segments) {
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		if r.codeLinePrint(w, line.Value(source)) {
+			r.warn(Warning{
+				Line:    bytes.Count(source[:line.Start], []byte{'\n'}) + 1,
+				Message: "code block line begins with a preformatting toggle",
+			})
+		}
+	}
+}
+
+// codeLinePrint prints a single line of preformatted text, rewriting a
+// preformatting toggle at its start like codeLinesPrint. It returns true if
+// the line was rewritten.
+func (r *GemRenderer) codeLinePrint(w io.Writer, value []byte) bool {
+	if !bytes.HasPrefix(value, []byte("```")) {
+		fmt.Fprintf(w, "%s", value)
+		return false
+	}
+	switch r.config.CodeFence {
+	case CodeFenceZeroWidth:
+		fmt.Fprintf(w, "\u200b")
+	case CodeFenceReplace:
+		fmt.Fprintf(w, "%s", r.config.CodeFenceSubstitute)
+		value = value[3:]
+	default:
+		fmt.Fprintf(w, " ")
+	}
+	fmt.Fprintf(w, "%s", value)
+	return true
+}
+
+// renderHTMLBlock converts an html block into gemtext if the HTML config option
+// is set to convert, otherwise it's skipped. Gemtext directives are always
+// copied as is.
 func (r *GemRenderer) renderHTMLBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
-	// Skip html block; can't be used.
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+	text := htmlBlockText(source, node.(*ast.HTMLBlock))
+	if content, ok := gemtextDirective(text); ok {
+		if content != "" {
+			fmt.Fprintf(w, "%s\n\n", content)
+		}
+		return ast.WalkSkipChildren, nil
+	}
+	if r.config.HTML == HTMLConvert {
+		if err := r.htmlPrint(w, source, node, r.htmlBlocks(text)); err != nil {
+			return ast.WalkStop, err
+		}
+	}
 	return ast.WalkSkipChildren, nil
 }
 
@@ -162,20 +320,88 @@ func (r *GemRenderer) renderList(w util.BufWriter, source []byte, node ast.Node,
 	n := node.(*ast.List)
 	if entering {
 		indent := "  "
+		number := n.Start
 
 		var buf bytes.Buffer
 		for nl := n.FirstChild(); nl != nil; nl = nl.NextSibling() {
+			// Hidden items aren't counted, so the numbers stay in sequence.
+			if r.hidden[nl] {
+				continue
+			}
+
+			// Items holding only links are printed as link lines instead.
+			links, err := r.listItemLinks(source, nl)
+			if err != nil {
+				return ast.WalkStop, err
+			}
+			if links != nil {
+				number++
+				linksPrint(w, r.dedup(links))
+				if !n.IsTight {
+					fmt.Fprintf(w, "\n")
+				}
+				continue
+			}
+
+			// The item's text is escaped like a paragraph. Its other blocks
+			// are escaped as they're rendered.
+			var skip [][2]int
 			for chld := nl.FirstChild(); chld != nil; chld = chld.NextSibling() {
-				sub := New()
-				if err := sub.Render(&buf, source, chld); err != nil {
+				if chld.Kind() == ast.KindTextBlock && !r.hidden[chld] {
+					s, err := r.inlinesRender(&buf, source, chld)
+					if err != nil {
+						return ast.WalkStop, err
+					}
+					skip = append(skip, s...)
+					if chld.NextSibling() != nil && chld.FirstChild() != nil {
+						fmt.Fprintf(&buf, "\n")
+					}
+					continue
+				}
+				start := buf.Len()
+				if err := r.render(&buf, source, chld); err != nil {
 					return ast.WalkStop, err
 				}
+				skip = append(skip, [2]int{start, buf.Len()})
 			}
 
-			// Print list item.
-			fmt.Fprintf(w, "* ")
+			// Images in tight list items follow the item's line, or take its
+			// place if the item holds nothing else.
+			images := r.listItemImages(source, nl)
+			imageOnly := len(images) > 0 && len(bytes.TrimSpace(buf.Bytes())) == 0
+			if r.config.Image == ImageOff {
+				images = nil
+			} else {
+				images = r.dedup(images)
+			}
+			if imageOnly {
+				buf.Reset()
+				number++
+				linksPrint(w, images)
+				if !n.IsTight {
+					fmt.Fprintf(w, "\n")
+				}
+				continue
+			}
+
+			// Print list item. Gemtext has no ordered lists so the numbers of
+			// ordered list items are printed as text.
+			switch {
+			case !n.IsOrdered() || r.config.OrderedList == OrderedListOff:
+				fmt.Fprintf(w, "* ")
+			case r.config.OrderedList == OrderedListBullet:
+				fmt.Fprintf(w, "* %d%c ", number, n.Marker)
+			default:
+				prefix := fmt.Sprintf("%d%c ", number, n.Marker)
+				indent = strings.Repeat(" ", len(prefix))
+				fmt.Fprint(w, prefix)
+			}
+			number++
+			if cb := taskCheckBox(nl); cb != nil {
+				r.checkBoxPrint(w, cb)
+			}
 
-			text := bytes.TrimSpace(buf.Bytes())
+			text := bytes.TrimSpace(r.escape(buf.Bytes(), skip...))
 			buf.Reset()
 
 			lines := bytes.SplitAfter(text, []byte{'\n'})
@@ -187,6 +413,7 @@ func (r *GemRenderer) renderList(w util.BufWriter, source []byte, node ast.Node,
 			}
 
 			fmt.Fprintf(w, "\n")
+			linksPrint(w, images)
 			if !n.IsTight {
 				fmt.Fprintf(w, "\n")
 			}
@@ -196,11 +423,151 @@ func (r *GemRenderer) renderList(w util.BufWriter, source []byte, node ast.Node,
 			fmt.Fprintf(w, "\n")
 		}
 
+		// Links in tight list items are printed below the list, like the
+		// links of a paragraph. Nested lists leave them to the outermost
+		// list.
+		if parent := n.Parent(); parent == nil || parent.Kind() != ast.KindListItem {
+			if linksPrint(w, r.dedup(r.listLinks(source, n))) {
+				fmt.Fprintf(w, "\n")
+			}
+		}
+
 		return ast.WalkSkipChildren, nil
 	}
 	return ast.WalkContinue, nil
 }
 
+// listLinks returns the links in the tight list items of a list and its nested
+// lists, based on the ParagraphLink config option. Links in items which are
+// printed as link lines are left out.
+func (r *GemRenderer) listLinks(source []byte, n *ast.List) []link {
+	var format string
+	switch r.config.ParagraphLink {
+	case ParagraphLinkOff, ParagraphLinkSection:
+		return nil
+	case ParagraphLinkCurlyBelow:
+		format = "{%s}"
+	}
+	var links []link
+	_ = ast.Walk(n, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+		if r.hidden[node] {
+			return ast.WalkSkipChildren, nil
+		}
+		switch node.Kind() {
+		case ast.KindListItem:
+			if items, _ := r.listItemLinks(source, node); items != nil {
+				return ast.WalkSkipChildren, nil
+			}
+		case ast.KindTextBlock:
+			links = append(links, r.inlineLinks(source, node, format, false)...)
+			return ast.WalkSkipChildren, nil
+		}
+		return ast.WalkContinue, nil
+	})
+	return links
+}
+
+// listItemImages returns the images in a tight list item as links.
+func (r *GemRenderer) listItemImages(source []byte, item ast.Node) []link {
+	var links []link
+	for text := item.FirstChild(); text != nil; text = text.NextSibling() {
+		if text.Kind() != ast.KindTextBlock {
+			continue
+		}
+		for child := text.FirstChild(); child != nil; child = child.NextSibling() {
+			if nl, ok := child.(*ast.Image); ok && !r.hidden[nl] {
+				if l, ok := r.image(source, nl); ok {
+					links = append(links, l)
+				}
+			}
+		}
+	}
+	return links
+}
+
+// listItemLinks returns the links of a list item which holds only links, or a
+// single link followed by a description such as "[name](url) - description",
+// in which case the description is used as the link's label. It returns nil
+// for any other list item.
+func (r *GemRenderer) listItemLinks(source []byte, item ast.Node) ([]link, error) {
+	text := item.FirstChild()
+	if text == nil || text != item.LastChild() || taskCheckBox(item) != nil {
+		return nil, nil
+	}
+	if text.Kind() != ast.KindTextBlock && text.Kind() != ast.KindParagraph {
+		return nil, nil
+	}
+
+	if linkOnly(source, text) {
+		var links []link
+		for child := text.FirstChild(); child != nil; child = child.NextSibling() {
+			if r.hidden[child] {
+				continue
+			}
+			if l, ok := r.link(source, child, ""); ok {
+				links = append(links, l)
+			}
+		}
+		return links, nil
+	}
+
+	first := text.FirstChild()
+	switch first.Kind() {
+	case ast.KindLink, ast.KindAutoLink, wast.KindWiki:
+	default:
+		return nil, nil
+	}
+	next, ok := first.NextSibling().(*ast.Text)
+	if !ok {
+		return nil, nil
+	}
+	separator := listItemSeparator(next.Segment.Value(source))
+	if separator == "" {
+		return nil, nil
+	}
+	// Descriptions with links of their own are left as list items, so
+	// their links are printed below the list like any other item's.
+	for child := ast.Node(next); child != nil; child = child.NextSibling() {
+		switch child.Kind() {
+		case ast.KindLink, ast.KindAutoLink, wast.KindWiki:
+			return nil, nil
+		}
+		if r.rawHTMLStart(source, child) == "a" {
+			return nil, nil
+		}
+	}
+
+	var buf bytes.Buffer
+	for child := ast.Node(next); child != nil; child = child.NextSibling() {
+		if err := r.render(&buf, source, child); err != nil {
+			return nil, err
+		}
+	}
+	description := bytes.TrimSpace(buf.Bytes())
+	description = bytes.TrimSpace(bytes.TrimPrefix(description, []byte(separator)))
+	l, ok := r.link(source, first, "")
+	if !ok || len(description) == 0 {
+		return nil, nil
+	}
+	l.label = string(description)
+	return []link{l}, nil
+}
+
+// listItemSeparator returns the dash separating a link from its description
+// at the start of s, or an empty string if there isn't one.
+func listItemSeparator(s []byte) string {
+	s = bytes.TrimLeft(s, " ")
+	for _, separator := range []string{"—", "–", "-"} {
+		if rest := bytes.TrimPrefix(s, []byte(separator)); len(rest) < len(s) && (len(rest) == 0 || rest[0] == ' ') {
+			return separator
+		}
+	}
+	return ""
+}
+
 func (r *GemRenderer) renderListItem(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
 	// Nothing to do.
 	return ast.WalkContinue, nil
@@ -212,12 +579,28 @@ func (r *GemRenderer) renderListItem(w util.BufWriter, source []byte, node ast.N
 // list of gemini links.
 func (r *GemRenderer) renderParagraphLinkOnly(w util.BufWriter, source []byte, n *ast.Paragraph, entering bool) (ast.WalkStatus, error) {
 	if !entering {
+		var links []link
 		for child := n.FirstChild(); child != nil; child = child.NextSibling() {
-			if linkPrint(w, source, child, r.config.LinkReplacers, "") {
-				fmt.Fprintf(w, "\n")
+			if r.hidden[child] {
+				continue
+			}
+			switch nl := child.(type) {
+			case *ast.Image:
+				if r.config.Image != ImageBelow {
+					continue
+				}
+				if l, ok := r.image(source, nl); ok {
+					links = append(links, l)
+				}
+			default:
+				if l, ok := r.link(source, nl, ""); ok {
+					links = append(links, l)
+				}
 			}
 		}
-		fmt.Fprintf(w, "\n")
+		if linksPrint(w, r.dedup(links)) {
+			fmt.Fprintf(w, "\n")
+		}
 	}
 	return ast.WalkContinue, nil
 }
@@ -230,10 +613,25 @@ func (r *GemRenderer) renderParagraphLinkOff(w util.BufWriter, source []byte, n
 		// We can make this check inside !entering, because link only
 		// paragraphs do not contain text. It's a weird quick of goldmark and
 		// this is the work-around.
-		if linkOnly(source, n) {
+		if r.linkOnly(source, n) {
 			return r.renderParagraphLinkOnly(w, source, n, entering)
 		}
 		fmt.Fprintf(w, "\n\n")
+
+		// Images are still printed below the paragraph.
+		if r.config.Image == ImageBelow {
+			var links []link
+			for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+				if nl, ok := child.(*ast.Image); ok && !r.hidden[nl] {
+					if l, ok := r.image(source, nl); ok {
+						links = append(links, l)
+					}
+				}
+			}
+			if linksPrint(w, r.dedup(links)) {
+				fmt.Fprintf(w, "\n")
+			}
+		}
 	}
 	return ast.WalkContinue, nil
 }
@@ -253,43 +651,99 @@ func (r *GemRenderer) renderParagraphLinkBelow(w util.BufWriter, source []byte,
 		// We can make this check inside !entering, because link only
 		// paragraphs do not contain text. It's a weird quick of goldmark and
 		// this is the work-around.
-		if linkOnly(source, n) {
+		if r.linkOnly(source, n) {
 			return r.renderParagraphLinkOnly(w, source, n, entering)
 		}
 		// Handle links in non-link-only paragraphs.
-		firstLink := true
-		for child := n.FirstChild(); child != nil; child = child.NextSibling() {
-			// We need to print new lines before the links rather than after. So
-			// first we use a type switch to ensure the current node is a link.
-			// Note than nl will be of type interface{}. This is a quirk of
-			// multi-type cases in go type switches.
-			switch nl := child.(type) {
-			case *ast.Link, *wast.Wiki, *ast.AutoLink:
-				if firstLink {
-					fmt.Fprintf(w, "\n\n")
-				} else {
-					fmt.Fprintf(w, "\n")
-				}
-				if linkPrint(w, source, nl, r.config.LinkReplacers, format) {
-					firstLink = false
-				}
-			}
-		}
+		links := r.inlineLinks(source, n, format, r.config.Image == ImageBelow)
 		fmt.Fprintf(w, "\n\n")
+		if linksPrint(w, r.dedup(links)) {
+			fmt.Fprintf(w, "\n")
+		}
 	}
 	return ast.WalkContinue, nil
 }
 
+// inlineLinks is a helper function that returns the links in a paragraph or
+// other block of inlines, to be printed below it. Links are formatted with
+// format, unless they're numbered. Images are included if images is true.
+func (r *GemRenderer) inlineLinks(source []byte, n ast.Node, format string, images bool) []link {
+	var links []link
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		if r.hidden[child] {
+			continue
+		}
+		// Note than nl will be of type ast.Node in the first case. This is
+		// a quirk of multi-type cases in go type switches.
+		switch nl := child.(type) {
+		case *ast.Link, *wast.Wiki, *ast.AutoLink, *ast.RawHTML:
+			// Numbered links use their number in the link text.
+			linkFormat := format
+			if number, ok := r.linkNumbers[nl]; ok {
+				linkFormat = fmt.Sprintf("[%d] %%s", number)
+			}
+			if l, ok := r.link(source, nl, linkFormat); ok {
+				links = append(links, l)
+			}
+		case *ast.Image:
+			if !images {
+				continue
+			}
+			if l, ok := r.image(source, nl); ok {
+				links = append(links, l)
+			}
+		}
+	}
+	return links
+}
+
 func (r *GemRenderer) renderParagraph(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
 	n := node.(*ast.Paragraph)
+	// Skip paragraphs which would be left empty after removing their images.
+	if r.config.Image == ImageOff && imageOnly(source, n) {
+		return ast.WalkSkipChildren, nil
+	}
+	// Links may be numbered again in each paragraph.
+	if entering && r.config.LinkDedup == LinkDedupParagraph {
+		r.numbersSeen = map[string]int{}
+	}
+	// Print the paragraph's text with lines which would be misread as
+	// another type of gemtext line escaped. The paragraph's links are still
+	// printed when exiting.
+	if entering && r.config.EscapePrefix != "" && !r.linkOnly(source, n) {
+		var buf bytes.Buffer
+		skip, err := r.inlinesRender(&buf, source, n)
+		if err != nil {
+			return ast.WalkStop, err
+		}
+		fmt.Fprintf(w, "%s", r.escape(buf.Bytes(), skip...))
+		return ast.WalkSkipChildren, nil
+	}
 	switch r.config.ParagraphLink {
-	case ParagraphLinkOff:
+	case ParagraphLinkOff, ParagraphLinkSection:
 		return r.renderParagraphLinkOff(w, source, n, entering)
 	default:
 		return r.renderParagraphLinkBelow(w, source, n, entering)
 	}
 }
 
+// inlinesRender is a helper function that renders the children of a block
+// into buf. It returns the ranges of buf which mustn't be escaped. Images
+// printed inline are real links and gemtext directives are copied as is.
+func (r *GemRenderer) inlinesRender(buf *bytes.Buffer, source []byte, n ast.Node) ([][2]int, error) {
+	var skip [][2]int
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		start := buf.Len()
+		if err := r.render(buf, source, child); err != nil {
+			return nil, err
+		}
+		if child.Kind() == ast.KindImage || rawGemtext(source, child) {
+			skip = append(skip, [2]int{start, buf.Len()})
+		}
+	}
+	return skip, nil
+}
+
 func (r *GemRenderer) renderTextBlock(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
 	n := node.(*ast.TextBlock)
 	if !entering {
@@ -0,0 +1,105 @@
+package gemtext
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// A CodeBlock is a fenced code block which is passed to a CodeBlockHandler.
+type CodeBlock struct {
+	// Language is the first word of the code block's info string.
+	Language string
+	// Alt is the alt text the code block would be printed with, based on the
+	// CodeBlockAlt config option.
+	Alt string
+	// Content is the text inside the code block.
+	Content []byte
+}
+
+// A CodeBlockHandler writes a fenced code block as gemtext. Handlers are chosen
+// by the code block's language using the CodeBlockHandlers config option.
+type CodeBlockHandler func(w io.Writer, block CodeBlock) error
+
+// CodeBlockVerbatim is a CodeBlockHandler which writes the content of a code
+// block as is. It's useful for code blocks which already contain gemtext.
+func CodeBlockVerbatim(w io.Writer, block CodeBlock) error {
+	_, err := w.Write(block.Content)
+	return err
+}
+
+// CodeBlockDescription is a CodeBlockHandler which replaces a code block with
+// its alt text. It's useful for diagrams, such as mermaid or dot, which can't
+// be displayed in gemtext.
+func CodeBlockDescription(w io.Writer, block CodeBlock) error {
+	_, err := io.WriteString(w, block.Alt)
+	return err
+}
+
+// CodeBlockCSV returns a CodeBlockHandler which writes a code block of comma
+// separated values as a table. The first record is used as the table's header.
+// The table is printed using the Table config options set by opts.
+func CodeBlockCSV(opts ...Option) CodeBlockHandler {
+	config := NewConfig()
+	for _, opt := range opts {
+		opt.SetConfig(config)
+	}
+	return func(w io.Writer, block CodeBlock) error {
+		reader := csv.NewReader(bytes.NewReader(block.Content))
+		reader.FieldsPerRecord = -1
+		records, err := reader.ReadAll()
+		if err != nil {
+			return err
+		}
+		if len(records) == 0 {
+			return nil
+		}
+		t := table{header: records[0], rows: records[1:]}
+		t.print(w, *config)
+		return nil
+	}
+}
+
+// codeBlockHandle is a helper function that writes a fenced code block using
+// its CodeBlockHandler. Returns false if it has no handler.
+func (r *GemRenderer) codeBlockHandle(w io.Writer, source []byte, n *ast.FencedCodeBlock) (bool, error) {
+	language := codeBlockLanguage(source, n)
+	handler, ok := r.config.CodeBlockHandlers[language]
+	if !ok || handler == nil {
+		return false, nil
+	}
+	var content bytes.Buffer
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		content.Write(line.Value(source))
+	}
+
+	var buf bytes.Buffer
+	err := handler(&buf, CodeBlock{
+		Language: language,
+		Alt:      r.codeBlockAlt(source, n),
+		Content:  content.Bytes(),
+	})
+	if err != nil {
+		return true, err
+	}
+	if text := bytes.TrimRight(buf.Bytes(), "\n"); len(text) > 0 {
+		fmt.Fprintf(w, "%s\n\n", text)
+	}
+	return true, nil
+}
+
+// codeBlockLanguage returns the language of a fenced code block, without any
+// attributes following it.
+func codeBlockLanguage(source []byte, n *ast.FencedCodeBlock) string {
+	language := string(n.Language(source))
+	if i := strings.IndexByte(language, '{'); i >= 0 {
+		language = language[:i]
+	}
+	return language
+}
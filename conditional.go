@@ -0,0 +1,74 @@
+package gemtext
+
+import (
+	"strings"
+
+	"github.com/yuin/goldmark/ast"
+)
+
+// Conditional directives are html comments which mark spans of content meant
+// for only one of the formats a document is published to. Content between
+// "<!-- web:only -->" and "<!-- /web -->" is left out of the gemtext, while
+// content between "<!-- gemini:only -->" and "<!-- /gemini -->" is kept.
+const (
+	webOnly    = "web:only"
+	webEnd     = "/web"
+	geminiOnly = "gemini:only"
+	geminiEnd  = "/gemini"
+)
+
+// conditionalDirective returns the keyword of an html comment which starts or
+// ends a conditional span, or an empty string if the html is anything other
+// than a single conditional directive.
+func conditionalDirective(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "<!--") || !strings.HasSuffix(s, "-->") || len(s) < 7 {
+		return ""
+	}
+	s = strings.TrimSpace(s[4 : len(s)-3])
+	switch s {
+	case webOnly, webEnd, geminiOnly, geminiEnd:
+		return s
+	}
+	return ""
+}
+
+// nodeDirective returns the conditional directive of an html block or raw html
+// inline, or an empty string if the node isn't one.
+func nodeDirective(source []byte, node ast.Node) string {
+	switch n := node.(type) {
+	case *ast.HTMLBlock:
+		return conditionalDirective(htmlBlockText(source, n))
+	case *ast.RawHTML:
+		return conditionalDirective(rawHTMLText(source, n))
+	}
+	return ""
+}
+
+// hiddenNodes returns the nodes in a document which are inside web only spans.
+// Spans are made of sibling nodes, so they can hold whole blocks or inlines
+// within a single paragraph. A span which is never ended runs until the end of
+// its parent.
+func hiddenNodes(source []byte, doc ast.Node) map[ast.Node]bool {
+	hidden := map[ast.Node]bool{}
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering || hidden[node] {
+			return ast.WalkContinue, nil
+		}
+		var hiding bool
+		for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+			switch nodeDirective(source, child) {
+			case webOnly:
+				hiding = true
+			case webEnd:
+				hiding = false
+			default:
+				if hiding {
+					hidden[child] = true
+				}
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+	return hidden
+}
@@ -1,6 +1,7 @@
 package gemtext
 
 import (
+	"bytes"
 	"fmt"
 
 	"git.sr.ht/~kota/fuckery"
@@ -39,6 +40,7 @@ func (r *GemRenderer) renderWiki(w util.BufWriter, source []byte, node ast.Node,
 		return ast.WalkSkipChildren, nil
 	}
 	curly := r.config.ParagraphLink == ParagraphLinkCurlyBelow
+	numbered := r.numbered(node)
 	if entering {
 		if curly {
 			fmt.Fprint(w, "{")
@@ -47,7 +49,209 @@ func (r *GemRenderer) renderWiki(w util.BufWriter, source []byte, node ast.Node,
 		if curly {
 			fmt.Fprint(w, "}")
 		}
+		if numbered {
+			fmt.Fprintf(w, "[%d]", r.linkNumber(source, node))
+		}
+	}
+
+	return ast.WalkContinue, nil
+}
+
+// renderTaskCheckBox skips task list checkboxes (per the github markdown
+// extension). Checkboxes are printed by renderList along with the list item's
+// bullet.
+func (r *GemRenderer) renderTaskCheckBox(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	return ast.WalkSkipChildren, nil
+}
+
+// taskCheckBox is a helper function that returns the checkbox of a task list
+// item or nil if the item isn't a task.
+func taskCheckBox(item ast.Node) *east.TaskCheckBox {
+	block := item.FirstChild()
+	if block == nil {
+		return nil
+	}
+	if cb, ok := block.FirstChild().(*east.TaskCheckBox); ok {
+		return cb
+	}
+	return nil
+}
+
+// checkBoxPrint is a helper function that prints a task list checkbox based on
+// the TaskList config option.
+func (r *GemRenderer) checkBoxPrint(w util.BufWriter, n *east.TaskCheckBox) {
+	switch r.config.TaskList {
+	case TaskListMarkdown:
+		if n.IsChecked {
+			fmt.Fprintf(w, "[x] ")
+		} else {
+			fmt.Fprintf(w, "[ ] ")
+		}
+	case TaskListUnicode:
+		if n.IsChecked {
+			fmt.Fprintf(w, "☑ ")
+		} else {
+			fmt.Fprintf(w, "☐ ")
+		}
 	}
+}
 
+// renderDefinitionList writes each term of a definition list (per the php
+// markdown extra extension) followed by its descriptions. How they're written
+// depends on the DefinitionList config option.
+func (r *GemRenderer) renderDefinitionList(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*east.DefinitionList)
+	if entering {
+		for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+			switch child.Kind() {
+			case east.KindDefinitionTerm:
+				text, err := r.inlineText(source, child)
+				if err != nil {
+					return ast.WalkStop, err
+				}
+				if child.PreviousSibling() != nil {
+					fmt.Fprintf(w, "\n\n")
+				}
+				r.definitionTermPrint(w, text)
+			case east.KindDefinitionDescription:
+				text, err := r.definitionDescriptionText(source, child)
+				if err != nil {
+					return ast.WalkStop, err
+				}
+				if child.PreviousSibling() != nil {
+					fmt.Fprintf(w, "\n")
+				}
+				r.definitionDescriptionPrint(w, text)
+			}
+		}
+		return ast.WalkSkipChildren, nil
+	} else {
+		fmt.Fprintf(w, "\n\n")
+		// Print the links in the terms and descriptions below the list.
+		if linksPrint(w, r.dedup(r.definitionLinks(source, n))) {
+			fmt.Fprintf(w, "\n")
+		}
+	}
 	return ast.WalkContinue, nil
 }
+
+// definitionDescriptionText is a helper function that returns the rendered
+// text of a definition list description. The text of its paragraphs is
+// rendered without their links, which are printed below the list instead.
+func (r *GemRenderer) definitionDescriptionText(source []byte, n ast.Node) ([]byte, error) {
+	var parts [][]byte
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		var text []byte
+		var err error
+		switch child.Kind() {
+		case ast.KindParagraph, ast.KindTextBlock:
+			if r.hidden[child] {
+				continue
+			}
+			text, err = r.inlineText(source, child)
+		default:
+			text, err = r.nodeText(source, child)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(text) > 0 {
+			parts = append(parts, text)
+		}
+	}
+	return bytes.Join(parts, []byte{'\n'}), nil
+}
+
+// definitionLinks returns the links in the terms and descriptions of a
+// definition list, based on the ParagraphLink config option. Like link only
+// paragraphs, terms and descriptions holding only links always have their
+// links printed.
+func (r *GemRenderer) definitionLinks(source []byte, n *east.DefinitionList) []link {
+	var format string
+	switch r.config.ParagraphLink {
+	case ParagraphLinkSection:
+		return nil
+	case ParagraphLinkCurlyBelow:
+		format = "{%s}"
+	}
+	var links []link
+	add := func(block ast.Node) {
+		if r.hidden[block] {
+			return
+		}
+		images := r.config.Image == ImageBelow || block.Kind() == ast.KindTextBlock
+		switch {
+		case linkOnly(source, block):
+			links = append(links, r.inlineLinks(source, block, "", images)...)
+		case r.config.ParagraphLink != ParagraphLinkOff:
+			links = append(links, r.inlineLinks(source, block, format, images)...)
+		}
+	}
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		if child.Kind() == east.KindDefinitionTerm {
+			add(child)
+			continue
+		}
+		for block := child.FirstChild(); block != nil; block = block.NextSibling() {
+			switch block.Kind() {
+			case ast.KindParagraph, ast.KindTextBlock:
+				add(block)
+			}
+		}
+	}
+	return links
+}
+
+func (r *GemRenderer) renderDefinitionTerm(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	// Nothing to do; handled by renderDefinitionList.
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *GemRenderer) renderDefinitionDescription(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	// Nothing to do; handled by renderDefinitionList.
+	return ast.WalkSkipChildren, nil
+}
+
+// definitionTermPrint is a helper function that prints a definition list term
+// as a heading or as bold text. Bold text is printed using the Emphasis config
+// option, so it's only bold if emphasis is printed at all.
+func (r *GemRenderer) definitionTermPrint(w util.BufWriter, text []byte) {
+	if r.config.DefinitionList == DefinitionListHeading {
+		fmt.Fprintf(w, "### %s", text)
+		if r.config.HeadingSpace == HeadingSpaceDouble {
+			fmt.Fprintf(w, "\n")
+		}
+		return
+	}
+	switch r.config.Emphasis {
+	case EmphasisMarkdown:
+		fmt.Fprintf(w, "**%s**", text)
+	case EmphasisUnicode:
+		fmt.Fprintf(w, "%s", fuckery.BoldSans(string(text)))
+	default:
+		fmt.Fprintf(w, "%s", r.escape(text))
+	}
+}
+
+// definitionDescriptionPrint is a helper function that prints a definition
+// list description as either a list item or a quote.
+func (r *GemRenderer) definitionDescriptionPrint(w util.BufWriter, text []byte) {
+	lines := bytes.SplitAfter(r.escape(text), []byte{'\n'})
+	if r.config.DefinitionList == DefinitionListQuote {
+		for _, line := range lines {
+			fmt.Fprintf(w, ">")
+			if len(line) > 0 && line[0] != '\n' {
+				fmt.Fprintf(w, " ")
+			}
+			fmt.Fprintf(w, "%s", line)
+		}
+		return
+	}
+	fmt.Fprintf(w, "* ")
+	for i, line := range lines {
+		if i > 0 && len(line) > 0 && line[0] != '\n' {
+			fmt.Fprint(w, "  ")
+		}
+		fmt.Fprintf(w, "%s", line)
+	}
+}
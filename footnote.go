@@ -0,0 +1,132 @@
+package gemtext
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/util"
+)
+
+// renderFootnoteLink writes a reference to a footnote as its number in square
+// brackets.
+func (r *GemRenderer) renderFootnoteLink(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*east.FootnoteLink)
+	if entering {
+		fmt.Fprintf(w, "[%d]", n.Index)
+	}
+	return ast.WalkContinue, nil
+}
+
+func (r *GemRenderer) renderFootnoteBacklink(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	// Skip backlinks; there's nowhere to link back to.
+	return ast.WalkSkipChildren, nil
+}
+
+// renderFootnoteList writes all footnotes in a section at the end of the
+// document. If footnotes are placed at the end of each heading section
+// instead, they've already been written by the time this is reached.
+func (r *GemRenderer) renderFootnoteList(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+	// The footnote list is always the last node in the document, so this is
+	// the end of the last heading section.
+	if err := r.sectionEnd(w, source, node.PreviousSibling()); err != nil {
+		return ast.WalkStop, err
+	}
+	if r.config.Footnote == FootnoteDocument {
+		fmt.Fprintf(w, "## Footnotes")
+		r.headingEnd(w)
+		for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+			if err := r.footnotePrint(w, source, child.(*east.Footnote)); err != nil {
+				return ast.WalkStop, err
+			}
+		}
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *GemRenderer) renderFootnote(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	// Nothing to do; handled by renderFootnoteList.
+	return ast.WalkSkipChildren, nil
+}
+
+// footnotePrint is a helper function that writes a footnote's number followed
+// by its content. Links in the footnote are printed below it just like in any
+// other paragraph.
+func (r *GemRenderer) footnotePrint(w util.BufWriter, source []byte, n *east.Footnote) error {
+	var buf bytes.Buffer
+	for child := n.FirstChild(); child != nil; child = child.NextSibling() {
+		if err := r.render(&buf, source, child); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(w, "[%d] %s\n\n", n.Index, bytes.TrimSpace(buf.Bytes()))
+
+	// Paragraphs don't print their links when they're collected at the end
+	// of each section, so the footnote's links are printed here instead.
+	if r.config.ParagraphLink == ParagraphLinkSection {
+		if linksPrint(w, r.dedup(r.sectionLinks(source, n.FirstChild(), n.LastChild()))) {
+			fmt.Fprintf(w, "\n")
+		}
+	}
+	return nil
+}
+
+// footnoteSection prints the footnotes referenced in a heading section, given
+// the first and last nodes in that section. Footnotes which have already been
+// printed in an earlier section are skipped.
+func (r *GemRenderer) footnoteSection(w util.BufWriter, source []byte, first, last ast.Node) error {
+	var list ast.Node
+	if doc := first.OwnerDocument(); doc != nil {
+		list = footnoteList(doc)
+	}
+	if list == nil {
+		return nil
+	}
+	for n := first; n != nil; n = n.NextSibling() {
+		if err := r.footnoteRefsPrint(w, source, list, n); err != nil {
+			return err
+		}
+		if n == last {
+			break
+		}
+	}
+	return nil
+}
+
+// footnoteRefsPrint prints the footnotes referenced in a node which haven't
+// been printed yet. Each footnote is followed by the footnotes referenced only
+// from inside it.
+func (r *GemRenderer) footnoteRefsPrint(w util.BufWriter, source []byte, list, node ast.Node) error {
+	return ast.Walk(node, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if r.hidden[n] {
+			return ast.WalkSkipChildren, nil
+		}
+		fl, ok := n.(*east.FootnoteLink)
+		if !entering || !ok || r.footnotesPrinted[fl.Index] {
+			return ast.WalkContinue, nil
+		}
+		r.footnotesPrinted[fl.Index] = true
+		for child := list.FirstChild(); child != nil; child = child.NextSibling() {
+			if fn := child.(*east.Footnote); fn.Index == fl.Index {
+				if err := r.footnotePrint(w, source, fn); err != nil {
+					return ast.WalkStop, err
+				}
+				return ast.WalkContinue, r.footnoteRefsPrint(w, source, list, fn)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+}
+
+// footnoteList returns the footnote list of a document or nil if it has none.
+// The footnote extension always places it at the end of the document.
+func footnoteList(doc *ast.Document) ast.Node {
+	if last := doc.LastChild(); last != nil && last.Kind() == east.KindFootnoteList {
+		return last
+	}
+	return nil
+}
@@ -0,0 +1,229 @@
+package gemtext
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+	"github.com/yuin/goldmark/util"
+)
+
+// KindFrontMatter is a NodeKind of the FrontMatterBlock node.
+var KindFrontMatter = ast.NewNodeKind("FrontMatter")
+
+// FrontMatterBlock is a block of YAML or TOML front matter at the very start of
+// a document. Its lines are the front matter without the delimiters.
+type FrontMatterBlock struct {
+	ast.BaseBlock
+
+	// Delimiter is the character used to fence the front matter; '-' for
+	// YAML and '+' for TOML.
+	Delimiter byte
+}
+
+// NewFrontMatterBlock returns a new FrontMatterBlock node.
+func NewFrontMatterBlock(delimiter byte) *FrontMatterBlock {
+	return &FrontMatterBlock{Delimiter: delimiter}
+}
+
+// Kind implements Node.Kind.
+func (n *FrontMatterBlock) Kind() ast.NodeKind {
+	return KindFrontMatter
+}
+
+// IsRaw implements Node.IsRaw.
+func (n *FrontMatterBlock) IsRaw() bool {
+	return true
+}
+
+// Dump implements Node.Dump.
+func (n *FrontMatterBlock) Dump(source []byte, level int) {
+	ast.DumpHelper(n, source, level, map[string]string{
+		"Delimiter": string(n.Delimiter),
+	}, nil)
+}
+
+// Fields returns the top level fields of the front matter. Only simple
+// "key: value" (YAML) or "key = value" (TOML) fields are read and quotes
+// around values are removed. Nested fields, lists, and tables are skipped.
+func (n *FrontMatterBlock) Fields(source []byte) map[string]string {
+	sep := ":"
+	if n.Delimiter == '+' {
+		sep = "="
+	}
+	fields := map[string]string{}
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		s := strings.TrimRight(string(line.Value(source)), "\r\n")
+		// Skip indented lines, comments, and tables.
+		if s == "" || s[0] == ' ' || s[0] == '\t' || s[0] == '#' || s[0] == '[' {
+			continue
+		}
+		j := strings.Index(s, sep)
+		if j < 0 {
+			continue
+		}
+		key := strings.Trim(strings.TrimSpace(s[:j]), `"'`)
+		value := strings.TrimSpace(s[j+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		fields[key] = value
+	}
+	return fields
+}
+
+// renderFrontMatter hides front matter, or prints it using the
+// FrontMatterTemplate config option. The template is executed with the front
+// matter's fields and missing fields are left empty.
+func (r *GemRenderer) renderFrontMatter(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	if !entering || r.config.FrontMatterTemplate == "" {
+		return ast.WalkSkipChildren, nil
+	}
+	n := node.(*FrontMatterBlock)
+	tmpl, err := template.New("front matter").Option("missingkey=zero").Parse(r.config.FrontMatterTemplate)
+	if err != nil {
+		return ast.WalkStop, err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, n.Fields(source)); err != nil {
+		return ast.WalkStop, err
+	}
+	if text := bytes.TrimSpace(buf.Bytes()); len(text) > 0 {
+		fmt.Fprintf(w, "%s\n\n", text)
+	}
+	return ast.WalkSkipChildren, nil
+}
+
+type frontMatterParser struct{}
+
+// NewFrontMatterParser returns a new parser.BlockParser that parses YAML front
+// matter fenced by "---" and TOML front matter fenced by "+++". Front matter is
+// only parsed on the first line of a document.
+func NewFrontMatterParser() parser.BlockParser {
+	return &frontMatterParser{}
+}
+
+// Trigger returns characters that trigger this parser.
+func (p *frontMatterParser) Trigger() []byte {
+	return []byte{'-', '+'}
+}
+
+// frontMatterDelimiter returns the delimiter of a front matter fence, or 0 if
+// the line isn't one.
+func frontMatterDelimiter(line []byte) byte {
+	line = util.TrimRightSpace(line)
+	switch {
+	case bytes.Equal(line, []byte("---")):
+		return '-'
+	case bytes.Equal(line, []byte("+++")):
+		return '+'
+	}
+	return 0
+}
+
+// frontMatterClosed returns true if source, the rest of the document after an
+// opening fence, has a closing fence for delimiter and every line before it
+// looks like front matter. Otherwise the opening line is left to be parsed as
+// something else, such as a thematic break.
+func frontMatterClosed(source []byte, delimiter byte) bool {
+	for len(source) > 0 {
+		line := source
+		if i := bytes.IndexByte(source, '\n'); i >= 0 {
+			line, source = source[:i+1], source[i+1:]
+		} else {
+			source = nil
+		}
+		if frontMatterDelimiter(line) == delimiter || delimiter == '-' && bytes.Equal(util.TrimRightSpace(line), []byte("...")) {
+			return true
+		}
+		if !frontMatterLine(line) {
+			return false
+		}
+	}
+	return false
+}
+
+// frontMatterLine returns true if a line could be part of YAML or TOML front
+// matter. That's a blank line, a comment, an indented continuation line, a
+// list item, a TOML table, or a "key: value" or "key = value" pair.
+func frontMatterLine(line []byte) bool {
+	line = util.TrimRightSpace(line)
+	switch {
+	case len(line) == 0:
+		return true
+	case line[0] == ' ', line[0] == '\t', line[0] == '#', line[0] == '[':
+		return true
+	case line[0] == '-' && (len(line) == 1 || line[1] == ' ' || line[1] == '\t'):
+		return true
+	}
+	i := bytes.IndexAny(line, ":=")
+	if i <= 0 || line[i] == ':' && i+1 < len(line) && line[i+1] != ' ' && line[i+1] != '\t' {
+		return false
+	}
+	// Keys are a single word unless they're quoted.
+	key := bytes.TrimSpace(line[:i])
+	return key[0] == '"' || key[0] == '\'' || !bytes.ContainsAny(key, " \t")
+}
+
+func (p *frontMatterParser) Open(parent ast.Node, reader text.Reader, pc parser.Context) (ast.Node, parser.State) {
+	line, segment := reader.PeekLine()
+	if parent.Kind() != ast.KindDocument || parent.HasChildren() || segment.Start != 0 {
+		return nil, parser.NoChildren
+	}
+	delimiter := frontMatterDelimiter(line)
+	if delimiter == 0 || !frontMatterClosed(reader.Source()[segment.Stop:], delimiter) {
+		return nil, parser.NoChildren
+	}
+	reader.Advance(segment.Len() - 1)
+	return NewFrontMatterBlock(delimiter), parser.NoChildren
+}
+
+func (p *frontMatterParser) Continue(node ast.Node, reader text.Reader, pc parser.Context) parser.State {
+	line, segment := reader.PeekLine()
+	n := node.(*FrontMatterBlock)
+	newline := 1
+	if len(line) == 0 || line[len(line)-1] != '\n' {
+		newline = 0
+	}
+	delimiter := frontMatterDelimiter(line)
+	if delimiter == n.Delimiter || n.Delimiter == '-' && bytes.Equal(util.TrimRightSpace(line), []byte("...")) {
+		reader.Advance(segment.Len() - newline)
+		return parser.Close
+	}
+	node.Lines().Append(segment)
+	reader.Advance(segment.Len() - newline)
+	return parser.Continue | parser.NoChildren
+}
+
+func (p *frontMatterParser) Close(node ast.Node, reader text.Reader, pc parser.Context) {
+	// nothing to do
+}
+
+func (p *frontMatterParser) CanInterruptParagraph() bool {
+	return false
+}
+
+func (p *frontMatterParser) CanAcceptIndentedLine() bool {
+	return false
+}
+
+type frontMatter struct{}
+
+// FrontMatter is a goldmark.Extender implementation which parses YAML or TOML
+// front matter at the start of a document. The gemtext renderer hides front
+// matter unless the FrontMatterTemplate config option is set.
+var FrontMatter = &frontMatter{}
+
+// Extend implements goldmark.Extender.
+func (e *frontMatter) Extend(m goldmark.Markdown) {
+	m.Parser().AddOptions(parser.WithBlockParsers(
+		util.Prioritized(NewFrontMatterParser(), 0),
+	))
+}
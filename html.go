@@ -0,0 +1,616 @@
+package gemtext
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"strings"
+
+	"git.sr.ht/~kota/fuckery"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/util"
+)
+
+// htmlTokenKind is the kind of an htmlToken.
+type htmlTokenKind uint8
+
+const (
+	htmlText htmlTokenKind = iota
+	htmlStartTag
+	htmlEndTag
+	htmlComment
+)
+
+// htmlToken is a piece of html; either text, a tag, or a comment.
+type htmlToken struct {
+	kind        htmlTokenKind
+	name        string
+	attrs       map[string]string
+	text        string
+	selfClosing bool
+}
+
+// htmlTokenize splits html into text, tags, and comments. It's not a complete
+// html parser, but it's good enough for the bits of html found in markdown.
+// Text and attribute values are unescaped and tag names are lowercased. Any
+// '<' which doesn't begin a tag is treated as text.
+func htmlTokenize(s string) []htmlToken {
+	var tokens []htmlToken
+	text := func(s string) {
+		if n := len(tokens); n > 0 && tokens[n-1].kind == htmlText {
+			tokens[n-1].text += html.UnescapeString(s)
+			return
+		}
+		tokens = append(tokens, htmlToken{kind: htmlText, text: html.UnescapeString(s)})
+	}
+	for len(s) > 0 {
+		i := strings.IndexByte(s, '<')
+		if i < 0 {
+			text(s)
+			break
+		}
+		if i > 0 {
+			text(s[:i])
+			s = s[i:]
+		}
+		token, n := htmlTag(s)
+		if n == 0 {
+			text("<")
+			s = s[1:]
+			continue
+		}
+		tokens = append(tokens, token)
+		s = s[n:]
+	}
+	return tokens
+}
+
+// htmlTag parses the tag or comment at the start of s and returns it along with
+// its length. A length of 0 is returned if s doesn't start with a tag.
+func htmlTag(s string) (htmlToken, int) {
+	switch {
+	case strings.HasPrefix(s, "<!--"):
+		end := strings.Index(s[4:], "-->")
+		if end < 0 {
+			return htmlToken{kind: htmlComment, text: s[4:]}, len(s)
+		}
+		return htmlToken{kind: htmlComment, text: s[4 : 4+end]}, 4 + end + 3
+	case strings.HasPrefix(s, "<!"), strings.HasPrefix(s, "<?"):
+		// Doctypes, cdata, and processing instructions.
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			return htmlToken{}, 0
+		}
+		return htmlToken{kind: htmlComment, text: s[2:end]}, end + 1
+	case strings.HasPrefix(s, "</"):
+		name := htmlName(s[2:])
+		if name == "" {
+			return htmlToken{}, 0
+		}
+		end := strings.IndexByte(s, '>')
+		if end < 0 {
+			return htmlToken{}, 0
+		}
+		return htmlToken{kind: htmlEndTag, name: strings.ToLower(name)}, end + 1
+	}
+
+	name := htmlName(s[1:])
+	if name == "" {
+		return htmlToken{}, 0
+	}
+	t := htmlToken{
+		kind:  htmlStartTag,
+		name:  strings.ToLower(name),
+		attrs: map[string]string{},
+	}
+	i := 1 + len(name)
+	for i < len(s) {
+		switch c := s[i]; {
+		case c == '>':
+			return t, i + 1
+		case c == '/':
+			t.selfClosing = true
+			i++
+		case isSpace(c):
+			i++
+		default:
+			j := i
+			for j < len(s) && !isSpace(s[j]) && s[j] != '=' && s[j] != '>' && s[j] != '/' {
+				j++
+			}
+			key := strings.ToLower(s[i:j])
+			for i = j; i < len(s) && isSpace(s[i]); i++ {
+			}
+			var val string
+			if i < len(s) && s[i] == '=' {
+				for i++; i < len(s) && isSpace(s[i]); i++ {
+				}
+				if i < len(s) && (s[i] == '"' || s[i] == '\'') {
+					end := strings.IndexByte(s[i+1:], s[i])
+					if end < 0 {
+						return htmlToken{}, 0
+					}
+					val = s[i+1 : i+1+end]
+					i += end + 2
+				} else {
+					for j = i; j < len(s) && !isSpace(s[j]) && s[j] != '>'; j++ {
+					}
+					val = s[i:j]
+					i = j
+				}
+			}
+			t.attrs[key] = html.UnescapeString(val)
+		}
+	}
+	// The tag was never closed.
+	return htmlToken{}, 0
+}
+
+// htmlName returns the tag name at the start of s.
+func htmlName(s string) string {
+	i := 0
+	for i < len(s) {
+		c := s[i]
+		if c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || i > 0 && (c >= '0' && c <= '9' || c == '-') {
+			i++
+			continue
+		}
+		break
+	}
+	return s[:i]
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// htmlBlockTags are the html tags which separate blocks of text.
+var htmlBlockTags = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"dd": true, "details": true, "div": true, "dl": true, "dt": true,
+	"figcaption": true, "figure": true, "footer": true, "header": true,
+	"hr": true, "li": true, "main": true, "nav": true, "ol": true, "p": true,
+	"section": true, "summary": true, "table": true, "tr": true, "ul": true,
+}
+
+// htmlHeadings are the html heading tags and their levels.
+var htmlHeadings = map[string]int{
+	"h1": 1, "h2": 2, "h3": 3, "h4": 4, "h5": 5, "h6": 6,
+}
+
+// htmlBlock is a block of gemtext converted from html.
+type htmlBlock struct {
+	text     string
+	heading  int
+	pre      bool
+	links    []link
+	linkOnly bool
+}
+
+// htmlConverter converts html into blocks of gemtext.
+type htmlConverter struct {
+	r       *GemRenderer
+	blocks  []htmlBlock
+	text    strings.Builder
+	heading int
+	links   []link
+	hasText bool
+	pre     int
+	skip    int
+
+	inLink bool
+	href   string
+	label  strings.Builder
+}
+
+// htmlBlocks is a helper function that converts html into blocks of gemtext.
+// Text is kept, links and images become link lines, line breaks are kept, and
+// preformatted text and headings are converted. Any other tags are stripped.
+func (r *GemRenderer) htmlBlocks(s string) []htmlBlock {
+	c := htmlConverter{r: r}
+	for _, t := range htmlTokenize(s) {
+		switch t.kind {
+		case htmlText:
+			c.writeText(t.text)
+		case htmlStartTag:
+			c.startTag(t)
+		case htmlEndTag:
+			c.endTag(t)
+		}
+	}
+	if c.pre > 0 {
+		c.flushPre()
+	}
+	c.flush()
+	return c.blocks
+}
+
+func (c *htmlConverter) writeText(s string) {
+	switch {
+	case c.skip > 0:
+	case c.pre > 0:
+		c.text.WriteString(s)
+	case c.inLink:
+		// Only line breaks begin a new line.
+		s = strings.ReplaceAll(s, "\n", " ")
+		c.text.WriteString(s)
+		c.label.WriteString(s)
+	default:
+		s = strings.ReplaceAll(s, "\n", " ")
+		c.text.WriteString(s)
+		if strings.TrimSpace(s) != "" {
+			c.hasText = true
+		}
+	}
+}
+
+func (c *htmlConverter) startTag(t htmlToken) {
+	if c.skip > 0 {
+		return
+	}
+	if c.pre > 0 {
+		switch t.name {
+		case "pre":
+			c.pre++
+		case "br":
+			c.text.WriteString("\n")
+		}
+		return
+	}
+
+	switch t.name {
+	case "script", "style":
+		if !t.selfClosing {
+			c.skip++
+		}
+	case "br":
+		c.text.WriteString("\n")
+	case "img":
+		if c.r.config.Image == ImageOff || t.attrs["src"] == "" {
+			return
+		}
+		c.links = append(c.links, link{
+			c.r.replaceLinks(t.attrs["src"], LinkImage),
+			c.r.imageLabel(t.attrs["alt"], t.attrs["title"]),
+		})
+	case "a":
+		if t.attrs["href"] == "" {
+			return
+		}
+		c.inLink = true
+		c.href = t.attrs["href"]
+		c.label.Reset()
+		if c.r.config.ParagraphLink == ParagraphLinkCurlyBelow && c.heading == 0 {
+			c.text.WriteString("{")
+		}
+	case "pre":
+		c.flush()
+		c.pre++
+	default:
+		if level, ok := htmlHeadings[t.name]; ok {
+			c.flush()
+			c.heading = level
+		} else if htmlBlockTags[t.name] {
+			c.flush()
+		}
+	}
+}
+
+func (c *htmlConverter) endTag(t htmlToken) {
+	switch {
+	case t.name == "script" || t.name == "style":
+		if c.skip > 0 {
+			c.skip--
+		}
+	case c.skip > 0:
+	case c.pre > 0:
+		if t.name == "pre" {
+			c.pre--
+			if c.pre == 0 {
+				c.flushPre()
+			}
+		}
+	case t.name == "a":
+		if !c.inLink {
+			return
+		}
+		c.inLink = false
+		l := link{
+			c.r.replaceLinks(c.href, LinkMarkdown),
+			strings.Join(strings.Fields(c.label.String()), " "),
+		}
+		switch {
+		case c.heading > 0:
+		case c.r.config.ParagraphLink == ParagraphLinkCurlyBelow:
+			c.text.WriteString("}")
+			l.label = "{" + l.label + "}"
+		case c.r.config.ParagraphLink == ParagraphLinkNumberedBelow:
+			number := c.r.destinationNumber(l.destination)
+			fmt.Fprintf(&c.text, "[%d]", number)
+			l.label = fmt.Sprintf("[%d] %s", number, l.label)
+		}
+		c.links = append(c.links, l)
+	default:
+		if _, ok := htmlHeadings[t.name]; ok || htmlBlockTags[t.name] {
+			c.flush()
+		}
+	}
+}
+
+// flush ends the current block of text, removing extra whitespace.
+func (c *htmlConverter) flush() {
+	lines := strings.Split(c.text.String(), "\n")
+	for i, line := range lines {
+		lines[i] = strings.Join(strings.Fields(line), " ")
+	}
+	text := strings.Trim(strings.Join(lines, "\n"), "\n")
+	// Empty headings are kept since they still begin a new section.
+	if text != "" || len(c.links) > 0 || c.heading > 0 {
+		c.blocks = append(c.blocks, htmlBlock{
+			text:     text,
+			heading:  c.heading,
+			links:    c.links,
+			linkOnly: !c.hasText && len(c.links) > 0,
+		})
+	}
+	c.text.Reset()
+	c.heading = 0
+	c.links = nil
+	c.hasText = false
+	c.inLink = false
+}
+
+// flushPre ends the current block of preformatted text.
+func (c *htmlConverter) flushPre() {
+	text := strings.Trim(c.text.String(), "\n")
+	if text != "" {
+		c.blocks = append(c.blocks, htmlBlock{text: text, pre: true})
+	}
+	c.text.Reset()
+}
+
+// htmlPrint is a helper function that prints blocks of gemtext converted from
+// the html block node. Links are printed below each block of text, just like
+// paragraphs. Headings in an html block in the document's root begin a new
+// section, just like markdown headings.
+func (r *GemRenderer) htmlPrint(w util.BufWriter, source []byte, node ast.Node, blocks []htmlBlock) error {
+	root := node.Parent() != nil && node.Parent().Kind() == ast.KindDocument
+	last := node.PreviousSibling()
+	var pending []link
+	for _, b := range blocks {
+		if b.heading > 0 && root {
+			// The links before the heading belong to the section it ends.
+			// The rest of the section is the nodes before the html block,
+			// or nothing after the block's first heading.
+			r.sectionHTMLLinks = pending
+			pending = nil
+			if err := r.sectionEnd(w, source, last); err != nil {
+				return err
+			}
+			last = nil
+		}
+		switch {
+		case b.linkOnly:
+			if linksPrint(w, r.dedup(b.links)) {
+				fmt.Fprintf(w, "\n")
+			}
+			continue
+		case b.pre:
+			fmt.Fprintf(w, "```\n")
+			for _, line := range strings.Split(b.text, "\n") {
+				if r.codeLinePrint(w, []byte(line)) {
+					r.warn(Warning{
+						Line:    htmlBlockLine(source, node),
+						Message: "code block line begins with a preformatting toggle",
+					})
+				}
+				fmt.Fprintf(w, "\n")
+			}
+			fmt.Fprintf(w, "```\n\n")
+			continue
+		case b.heading > 0:
+			if b.text == "" && len(b.links) == 0 {
+				continue
+			}
+			if marker, ok := r.headingMarker(b.heading); ok {
+				fmt.Fprintf(w, "%s%s", marker, b.text)
+			} else {
+				fmt.Fprintf(w, "%s", fuckery.BoldSans(b.text))
+			}
+			r.headingEnd(w)
+		default:
+			fmt.Fprintf(w, "%s\n\n", r.escape([]byte(b.text)))
+			if r.config.ParagraphLink == ParagraphLinkSection {
+				pending = append(pending, b.links...)
+			}
+		}
+		if r.config.ParagraphLink != ParagraphLinkOff && r.config.ParagraphLink != ParagraphLinkSection {
+			if linksPrint(w, r.dedup(b.links)) {
+				fmt.Fprintf(w, "\n")
+			}
+		}
+	}
+	return nil
+}
+
+// htmlSectionStart returns true if node is an html block which is converted
+// into gemtext with a heading, so it begins a new heading section.
+func (r *GemRenderer) htmlSectionStart(source []byte, node ast.Node) bool {
+	n, ok := node.(*ast.HTMLBlock)
+	if !ok || r.config.HTML != HTMLConvert || r.hidden[node] {
+		return false
+	}
+	return htmlHasHeading(htmlBlockText(source, n))
+}
+
+// htmlHasHeading returns true if converting html would print a heading. It
+// skips the same tags as htmlBlocks, without converting anything.
+func htmlHasHeading(s string) bool {
+	var pre, skip int
+	for _, t := range htmlTokenize(s) {
+		switch {
+		case t.kind == htmlEndTag && (t.name == "script" || t.name == "style"):
+			if skip > 0 {
+				skip--
+			}
+		case skip > 0:
+		case pre > 0:
+			switch {
+			case t.kind == htmlStartTag && t.name == "pre":
+				pre++
+			case t.kind == htmlEndTag && t.name == "pre":
+				pre--
+			}
+		case t.kind != htmlStartTag:
+		case t.name == "script" || t.name == "style":
+			if !t.selfClosing {
+				skip++
+			}
+		case t.name == "pre":
+			pre++
+		default:
+			if _, ok := htmlHeadings[t.name]; ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// htmlBlockLine returns the line number of the start of an html block.
+func htmlBlockLine(source []byte, node ast.Node) int {
+	lines := node.Lines()
+	if lines.Len() == 0 {
+		return 0
+	}
+	return bytes.Count(source[:lines.At(0).Start], []byte{'\n'}) + 1
+}
+
+// htmlBlockText returns the html of an html block.
+func htmlBlockText(source []byte, n *ast.HTMLBlock) string {
+	var b strings.Builder
+	lines := n.Lines()
+	for i := 0; i < lines.Len(); i++ {
+		line := lines.At(i)
+		b.Write(line.Value(source))
+	}
+	if n.HasClosure() {
+		b.Write(n.ClosureLine.Value(source))
+	}
+	return b.String()
+}
+
+// rawHTMLText returns the html of a raw html inline.
+func rawHTMLText(source []byte, n *ast.RawHTML) string {
+	var b strings.Builder
+	for i := 0; i < n.Segments.Len(); i++ {
+		segment := n.Segments.At(i)
+		b.Write(segment.Value(source))
+	}
+	return b.String()
+}
+
+// rawHTMLTag returns the first tag of a raw html inline or false if it has
+// none.
+func rawHTMLTag(source []byte, n *ast.RawHTML) (htmlToken, bool) {
+	for _, t := range htmlTokenize(rawHTMLText(source, n)) {
+		if t.kind == htmlStartTag || t.kind == htmlEndTag {
+			return t, true
+		}
+	}
+	return htmlToken{}, false
+}
+
+// rawHTMLLabel returns the label of a raw html link or image. The label of a
+// link is the text between its start and end tags.
+func (r *GemRenderer) rawHTMLLabel(source []byte, n *ast.RawHTML) string {
+	t, _ := rawHTMLTag(source, n)
+	if t.name == "img" {
+		return r.imageLabel(t.attrs["alt"], t.attrs["title"])
+	}
+	var label strings.Builder
+	for sibling := n.NextSibling(); sibling != nil; sibling = sibling.NextSibling() {
+		if raw, ok := sibling.(*ast.RawHTML); ok {
+			if t, ok := rawHTMLTag(source, raw); ok && t.kind == htmlEndTag && t.name == "a" {
+				break
+			}
+			continue
+		}
+		label.Write(sibling.Text(source))
+		if t, ok := sibling.(*ast.Text); ok && t.SoftLineBreak() {
+			label.WriteString(" ")
+		}
+	}
+	return strings.TrimSpace(label.String())
+}
+
+// rawHTMLLinkStart returns the raw html start tag of the link which a raw html
+// end tag closes, or nil if it has none.
+func rawHTMLLinkStart(source []byte, n *ast.RawHTML) *ast.RawHTML {
+	for sibling := n.PreviousSibling(); sibling != nil; sibling = sibling.PreviousSibling() {
+		if raw, ok := sibling.(*ast.RawHTML); ok {
+			if t, ok := rawHTMLTag(source, raw); ok && t.name == "a" {
+				if t.kind == htmlStartTag && t.attrs["href"] != "" {
+					return raw
+				}
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// rawHTMLStart returns the name of the first tag of a node if it's an html
+// start tag which is being converted, or an empty string otherwise.
+func (r *GemRenderer) rawHTMLStart(source []byte, node ast.Node) string {
+	n, ok := node.(*ast.RawHTML)
+	if !ok || r.config.HTML == HTMLOff {
+		return ""
+	}
+	if t, ok := rawHTMLTag(source, n); ok && t.kind == htmlStartTag {
+		return t.name
+	}
+	return ""
+}
+
+// gemtextDirective returns the content of an html comment which begins with
+// "gemtext" or "gmi", such as "<!-- gemtext => /about.gmi About me -->".
+// The content is meant to be copied into the output as is. Returns false if
+// the html is anything other than a single gemtext directive.
+func gemtextDirective(s string) (string, bool) {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "<!--") || !strings.HasSuffix(s, "-->") || len(s) < 7 {
+		return "", false
+	}
+	s = s[4 : len(s)-3]
+	if strings.Contains(s, "-->") {
+		return "", false
+	}
+	s = strings.TrimLeft(s, " \t")
+	for _, keyword := range []string{"gemtext", "gmi"} {
+		if !strings.HasPrefix(s, keyword) {
+			continue
+		}
+		content := s[len(keyword):]
+		if content != "" && !isSpace(content[0]) {
+			continue
+		}
+		// Keep the indentation of block directives.
+		if i := strings.IndexByte(content, '\n'); i >= 0 && strings.TrimSpace(content[:i]) == "" {
+			content = content[i+1:]
+		}
+		return strings.TrimRight(strings.TrimLeft(content, " \t"), " \t\r\n"), true
+	}
+	return "", false
+}
+
+// rawGemtext returns true if node is a raw html inline containing a gemtext
+// directive.
+func rawGemtext(source []byte, node ast.Node) bool {
+	n, ok := node.(*ast.RawHTML)
+	if !ok {
+		return false
+	}
+	_, ok = gemtextDirective(rawHTMLText(source, n))
+	return ok
+}
@@ -1,6 +1,7 @@
 package gemtext
 
 import (
+	"bytes"
 	"fmt"
 
 	"git.sr.ht/~kota/fuckery"
@@ -61,24 +62,38 @@ func (r *GemRenderer) renderEmphasis(w util.BufWriter, source []byte, node ast.N
 	return ast.WalkContinue, nil
 }
 
+// renderImage writes an image as a link based on the Image config option.
+// Images which are printed below their paragraph are handled by the paragraph
+// instead.
 func (r *GemRenderer) renderImage(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
 	n := node.(*ast.Image)
 	if entering {
-		// Apply link replacers.
-		destination := n.Destination
-		for _, r := range r.config.LinkReplacers {
-			s := r.replace(string(destination), LinkImage)
-			destination = []byte(s)
+		switch r.config.Image {
+		case ImageOff:
+			return ast.WalkSkipChildren, nil
+		case ImageBelow:
+			if n.Parent().Kind() == ast.KindParagraph {
+				return ast.WalkSkipChildren, nil
+			}
 		}
-
-		fmt.Fprintf(w, "=> ")
-		fmt.Fprintf(w, "%s ", destination)
-	} else {
-		if n.NextSibling() != nil && n.FirstChild() != nil {
+		// Link lines can't be part of a list item's line, so images in
+		// tight list items are printed after the item by renderList.
+		if n.Parent().Kind() == ast.KindTextBlock {
+			return ast.WalkSkipChildren, nil
+		}
+		// Images in paragraphs are printed on their own line, so break the
+		// line if there's text before the image.
+		prev := n.PreviousSibling()
+		if prev != nil && prev.Kind() != ast.KindImage && n.Parent().Kind() == ast.KindParagraph {
+			if t, ok := prev.(*ast.Text); !ok || len(t.Segment.Value(source)) > 0 {
+				fmt.Fprintf(w, "\n")
+			}
+		}
+		if r.imagePrint(w, source, n) && n.NextSibling() != nil {
 			fmt.Fprintf(w, "\n")
 		}
 	}
-	return ast.WalkContinue, nil
+	return ast.WalkSkipChildren, nil
 }
 
 func (r *GemRenderer) renderLink(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
@@ -86,6 +101,7 @@ func (r *GemRenderer) renderLink(w util.BufWriter, source []byte, node ast.Node,
 		return ast.WalkSkipChildren, nil
 	}
 	curly := r.config.ParagraphLink == ParagraphLinkCurlyBelow && node.Parent().Kind() != ast.KindHeading
+	numbered := r.numbered(node)
 	if entering {
 		if curly {
 			fmt.Fprint(w, "{")
@@ -94,28 +110,90 @@ func (r *GemRenderer) renderLink(w util.BufWriter, source []byte, node ast.Node,
 		if curly {
 			fmt.Fprint(w, "}")
 		}
+		if numbered {
+			fmt.Fprintf(w, "[%d]", r.linkNumber(source, node))
+		}
 	}
 
 	return ast.WalkContinue, nil
 }
 
+// renderRawHTML converts inline html if the HTML config option is set to
+// convert, otherwise it's skipped. Line breaks are kept and links are marked
+// just like markdown links, which are printed below the paragraph. Any other
+// tags are stripped. Gemtext directives are always copied as is.
 func (r *GemRenderer) renderRawHTML(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
-	// skip raw html - can't be used
+	if !entering {
+		return ast.WalkSkipChildren, nil
+	}
+	n := node.(*ast.RawHTML)
+	if content, ok := gemtextDirective(rawHTMLText(source, n)); ok {
+		fmt.Fprintf(w, "%s", content)
+		return ast.WalkSkipChildren, nil
+	}
+	if r.config.HTML == HTMLOff {
+		return ast.WalkSkipChildren, nil
+	}
+	t, ok := rawHTMLTag(source, n)
+	if !ok {
+		return ast.WalkSkipChildren, nil
+	}
+	curly := r.config.ParagraphLink == ParagraphLinkCurlyBelow && node.Parent().Kind() != ast.KindHeading
+	numbered := r.numbered(node)
+	switch {
+	case t.kind == htmlStartTag && t.name == "br":
+		fmt.Fprintf(w, "\n")
+	case t.kind == htmlStartTag && t.name == "a" && t.attrs["href"] != "":
+		if curly {
+			fmt.Fprint(w, "{")
+		}
+	case t.kind == htmlEndTag && t.name == "a":
+		start := rawHTMLLinkStart(source, n)
+		if start == nil {
+			break
+		}
+		if curly {
+			fmt.Fprint(w, "}")
+		}
+		if numbered {
+			fmt.Fprintf(w, "[%d]", r.linkNumber(source, start))
+		}
+	}
 	return ast.WalkSkipChildren, nil
 }
 
 func (r *GemRenderer) renderText(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
 	// skip if the parent node contains only links
-	if linkOnly(source, node.Parent()) {
+	if r.linkOnly(source, node.Parent()) {
 		return ast.WalkSkipChildren, nil
 	}
 	n := node.(*ast.Text)
 	if entering {
-		fmt.Fprintf(w, "%s", n.Segment.Value(source))
+		// Attribute lists are never printed, and nothing follows them.
+		value, last := r.textValue(source, n)
+		// Images are never printed inline, so remove the space after them.
+		prev := n.PreviousSibling()
+		if prev != nil && (prev.Kind() == ast.KindImage || r.rawHTMLStart(source, prev) == "img") {
+			value = bytes.TrimLeft(value, " ")
+		}
+		// The line is broken before images printed inline, so remove the
+		// space before them too.
+		next := n.NextSibling()
+		inlineImage := next != nil && next.Kind() == ast.KindImage && r.config.Image == ImageInline && n.Parent().Kind() == ast.KindParagraph
+		if inlineImage {
+			value = bytes.TrimRight(value, " ")
+		}
+		fmt.Fprintf(w, "%s", value)
+		if last {
+			return ast.WalkContinue, nil
+		}
 		// use a space for soft line breaks unless the next node is an image
+		// printed on its own line or the line was already broken by an image
+		// or html
 		if n.SoftLineBreak() {
-			if n.NextSibling().Kind() != ast.KindImage {
-				fmt.Fprintf(w, " ")
+			lineBreak := len(value) == 0 && prev != nil && (prev.Kind() == ast.KindImage || r.rawHTMLStart(source, prev) == "br")
+			if !lineBreak && !inlineImage {
+				fmt.Fprintf(w, "%s", r.softBreak(n))
 			}
 		}
 		if n.HardLineBreak() {
@@ -125,6 +203,22 @@ func (r *GemRenderer) renderText(w util.BufWriter, source []byte, node ast.Node,
 	return ast.WalkContinue, nil
 }
 
+// softBreak returns the text printed for a soft line break in node, based on
+// the SoftBreak config option.
+func (r *GemRenderer) softBreak(node ast.Node) string {
+	switch r.config.SoftBreak {
+	case SoftBreakNewline:
+		return "\n"
+	case SoftBreakBlockquote:
+		for p := node.Parent(); p != nil; p = p.Parent() {
+			if p.Kind() == ast.KindBlockquote {
+				return "\n"
+			}
+		}
+	}
+	return " "
+}
+
 func (r *GemRenderer) renderString(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
 	if !entering {
 		return ast.WalkContinue, nil
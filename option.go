@@ -5,29 +5,114 @@ import "regexp"
 // HR is the default HorizontalRule string used in NewConfig.
 const HR = ""
 
+// HeadingMarker is the default HeadingMarker string used in NewConfig.
+const HeadingMarker = ""
+
+// TableWidth is the default TableWidth used in NewConfig.
+const TableWidth = 80
+
+// TOCDepth is the default TOCDepth used in NewConfig.
+const TOCDepth = 3
+
+// TOCLabel is the default TOCLabel used in NewConfig.
+const TOCLabel = "Contents"
+
+// SplitLevel is the default SplitLevel used in NewConfig.
+const SplitLevel = 2
+
+// CodeFenceSubstitute is the default CodeFenceSubstitute used in NewConfig.
+const CodeFenceSubstitute = "~~~"
+
+// EscapePrefix is the default EscapePrefix used in NewConfig; a zero width
+// space.
+const EscapePrefix = "\u200b"
+
 // Config has configurations for the gemini renderer.
 type Config struct {
-	HeadingLink    HeadingLink
-	HeadingSpace   HeadingSpace
-	ParagraphLink  ParagraphLink
-	Emphasis       Emphasis
-	Strikethrough  Strikethrough
-	CodeSpan       CodeSpan
-	HorizontalRule string
-	LinkReplacers  []LinkReplacer
+	HeadingLink           HeadingLink
+	HeadingSpace          HeadingSpace
+	HeadingLevel          HeadingLevel
+	HeadingMarker         string
+	HeadingOffset         int
+	ParagraphLink         ParagraphLink
+	Emphasis              Emphasis
+	Strikethrough         Strikethrough
+	CodeSpan              CodeSpan
+	HorizontalRule        string
+	LinkReplacers         []LinkReplacer
+	Table                 Table
+	TableWidth            int
+	Footnote              Footnote
+	TaskList              TaskList
+	DefinitionList        DefinitionList
+	OrderedList           OrderedList
+	Image                 Image
+	ImageLabel            ImageLabel
+	ImagePrefix           string
+	ImageFallback         string
+	LinkDedup             LinkDedup
+	LinkDedupLabel        LinkDedupLabel
+	HTML                  HTML
+	FrontMatterTemplate   string
+	TOC                   TOC
+	TOCDepth              int
+	TOCLabel              string
+	SplitLevel            int
+	SoftBreak             SoftBreak
+	EscapePrefix          string
+	CodeFence             CodeFence
+	CodeFenceSubstitute   string
+	Warn                  func(Warning)
+	CodeBlockAlt          CodeBlockAlt
+	CodeBlockDescriptions map[string]string
+	CodeBlockAltDefault   string
+	CodeBlockHandlers     map[string]CodeBlockHandler
 }
 
 // NewConfig returns a new Config with defaults.
 func NewConfig() *Config {
 	return &Config{
-		HeadingLink:    HeadingLinkAuto,
-		HeadingSpace:   HeadingSpaceDouble,
-		ParagraphLink:  ParagraphLinkBelow,
-		Emphasis:       EmphasisOff,
-		Strikethrough:  StrikethroughOff,
-		CodeSpan:       CodeSpanOff,
-		HorizontalRule: HR,
-		LinkReplacers:  []LinkReplacer{},
+		HeadingLink:           HeadingLinkAuto,
+		HeadingSpace:          HeadingSpaceDouble,
+		HeadingLevel:          HeadingLevelClamp,
+		HeadingMarker:         HeadingMarker,
+		HeadingOffset:         0,
+		ParagraphLink:         ParagraphLinkBelow,
+		Emphasis:              EmphasisOff,
+		Strikethrough:         StrikethroughOff,
+		CodeSpan:              CodeSpanOff,
+		HorizontalRule:        HR,
+		LinkReplacers:         []LinkReplacer{},
+		Table:                 TablePreformatted,
+		TableWidth:            TableWidth,
+		Footnote:              FootnoteDocument,
+		TaskList:              TaskListMarkdown,
+		DefinitionList:        DefinitionListList,
+		OrderedList:           OrderedListText,
+		Image:                 ImageInline,
+		ImageLabel:            ImageLabelAlt,
+		ImagePrefix:           "",
+		ImageFallback:         "",
+		LinkDedup:             LinkDedupOff,
+		LinkDedupLabel:        LinkDedupLabelFirst,
+		HTML:                  HTMLOff,
+		FrontMatterTemplate:   "",
+		TOC:                   TOCOff,
+		TOCDepth:              TOCDepth,
+		TOCLabel:              TOCLabel,
+		SplitLevel:            SplitLevel,
+		SoftBreak:             SoftBreakSpace,
+		EscapePrefix:          EscapePrefix,
+		CodeFence:             CodeFenceIndent,
+		CodeFenceSubstitute:   CodeFenceSubstitute,
+		Warn:                  nil,
+		CodeBlockAlt:          CodeBlockAltRaw,
+		CodeBlockDescriptions: map[string]string{},
+		CodeBlockAltDefault:   "",
+		CodeBlockHandlers: map[string]CodeBlockHandler{
+			"gemtext": CodeBlockVerbatim,
+			"gmi":     CodeBlockVerbatim,
+		},
 	}
 }
 
@@ -93,6 +178,56 @@ const (
 	HeadingSpaceDouble
 )
 
+// Set HeadingLevel mode.
+func WithHeadingLevel(val HeadingLevel) Option {
+	return OptionFunc(func(c *Config) {
+		c.HeadingLevel = val
+	})
+}
+
+// HeadingLevel is an enum config option that controls how heading levels are
+// treated. Gemtext only has three levels of headings while markdown has six.
+type HeadingLevel uint8
+
+const (
+	// Print headings deeper than level 3 as level 3 headings.
+	HeadingLevelClamp HeadingLevel = iota
+	// Print headings deeper than level 3 as a line of text starting with
+	// HeadingMarker.
+	HeadingLevelText
+	// Print headings deeper than level 3 as a line of text using 𝘄𝗲𝗶𝗿𝗱
+	// 𝘶𝘯𝘪𝘤𝘰𝘥𝘦 hacks to make it bold.
+	// NOTE: The current generation of screenreaders are unable to handle this
+	// hack. The symbols are meant for mathematics and are pronounced
+	// individually as such. As a result you should ONLY use this option if
+	// you're providing an alternative accessible copy of your document.
+	HeadingLevelUnicode
+	// Shift every heading up by HeadingOffset levels. Headings which are
+	// still deeper than level 3 are printed as level 3 headings. This is
+	// useful for documents which only use their first level for a title, or
+	// don't use the first levels at all. Since it's a separate mode, deep
+	// headings can't also be printed as with HeadingLevelText or
+	// HeadingLevelUnicode.
+	HeadingLevelOffset
+)
+
+// Set HeadingMarker string. This is printed before the text of deep headings
+// when using HeadingLevelText.
+func WithHeadingMarker(val string) Option {
+	return OptionFunc(func(c *Config) {
+		c.HeadingMarker = val
+	})
+}
+
+// Set HeadingOffset. This is the number of levels every heading is shifted up
+// by when using HeadingLevelOffset. It's ignored by every other HeadingLevel
+// mode, including HeadingLevelText and HeadingLevelUnicode.
+func WithHeadingOffset(val int) Option {
+	return OptionFunc(func(c *Config) {
+		c.HeadingOffset = val
+	})
+}
+
 // Set ParagraphLink mode.
 func WithParagraphLink(val ParagraphLink) Option {
 	return OptionFunc(func(c *Config) {
@@ -111,6 +246,13 @@ const (
 	ParagraphLinkBelow
 	// Delimit link text with curly braces and print the below the paragraph.
 	ParagraphLinkCurlyBelow
+	// Follow link text with a number in square brackets and print the links
+	// below the paragraph, list, or table labeled with the same number. Links
+	// are numbered continuously across the whole document.
+	ParagraphLinkNumberedBelow
+	// Print the links of every paragraph, list, quote, and table in a heading
+	// section together at the end of that section, before the next heading.
+	ParagraphLinkSection
 )
 
 // Set Emphasis mode.
@@ -224,3 +366,422 @@ func WithLinkReplacers(r []LinkReplacer) Option {
 		c.LinkReplacers = r
 	})
 }
+
+// Set Table mode.
+func WithTable(val Table) Option {
+	return OptionFunc(func(c *Config) {
+		c.Table = val
+	})
+}
+
+// Table is an enum config option that controls how markdown tables (per the
+// github markdown extension) are treated.
+type Table uint8
+
+const (
+	// Skip tables; nothing is printed.
+	TableOff Table = iota
+	// Print tables as a preformatted block with ascii borders. Tables wider
+	// than TableWidth are printed as a TableRowList instead.
+	TablePreformatted
+	// Print each row of a table as a list of "header: value" items.
+	TableRowList
+)
+
+// Set TableWidth. This is the widest a preformatted table may be, in
+// characters, before falling back to TableRowList. A value of 0 or less means
+// tables have no width limit.
+func WithTableWidth(val int) Option {
+	return OptionFunc(func(c *Config) {
+		c.TableWidth = val
+	})
+}
+
+// Set Footnote mode.
+func WithFootnote(val Footnote) Option {
+	return OptionFunc(func(c *Config) {
+		c.Footnote = val
+	})
+}
+
+// Footnote is an enum config option that controls where footnotes (per the
+// footnote markdown extension) are printed. References to a footnote are
+// always printed as its number in square brackets.
+type Footnote uint8
+
+const (
+	// Print all footnotes in a "Footnotes" section at the end of the
+	// document.
+	FootnoteDocument Footnote = iota
+	// Print footnotes at the end of the heading section where they're first
+	// referenced, before the next heading.
+	FootnoteSection
+)
+
+// Set TaskList mode.
+func WithTaskList(val TaskList) Option {
+	return OptionFunc(func(c *Config) {
+		c.TaskList = val
+	})
+}
+
+// TaskList is an enum config option that controls how the checkboxes of task
+// list items (per the github markdown extension) are treated.
+type TaskList uint8
+
+const (
+	// Strip out task list checkboxes.
+	TaskListOff TaskList = iota
+	// Print task list checkboxes as markdown ([x] and [ ]).
+	TaskListMarkdown
+	// Print task list checkboxes as unicode ballot boxes (☑ and ☐).
+	TaskListUnicode
+)
+
+// Set DefinitionList mode.
+func WithDefinitionList(val DefinitionList) Option {
+	return OptionFunc(func(c *Config) {
+		c.DefinitionList = val
+	})
+}
+
+// DefinitionList is an enum config option that controls how definition lists
+// (per the php markdown extra extension) are treated. Terms printed as bold
+// text follow the Emphasis option, so they're only bold when emphasis is
+// printed at all.
+type DefinitionList uint8
+
+const (
+	// Print each term as bold text followed by its descriptions as a list.
+	DefinitionListList DefinitionList = iota
+	// Print each term as bold text followed by its descriptions as quotes.
+	DefinitionListQuote
+	// Print each term as a level 3 heading followed by its descriptions as a
+	// list.
+	DefinitionListHeading
+)
+
+// Set OrderedList mode.
+func WithOrderedList(val OrderedList) Option {
+	return OptionFunc(func(c *Config) {
+		c.OrderedList = val
+	})
+}
+
+// OrderedList is an enum config option that controls how markdown ordered
+// lists are treated. Gemtext only has unordered lists.
+type OrderedList uint8
+
+const (
+	// Print ordered lists as unordered lists, dropping their numbers.
+	OrderedListOff OrderedList = iota
+	// Print each item of an ordered list as a line of text starting with its
+	// number and the list's original delimiter (1. or 1)).
+	OrderedListText
+	// Print ordered lists as unordered lists with each item's number written
+	// after the bullet.
+	OrderedListBullet
+)
+
+// Set Image mode.
+func WithImage(val Image) Option {
+	return OptionFunc(func(c *Config) {
+		c.Image = val
+	})
+}
+
+// Image is an enum config option that controls where markdown images are
+// printed. Images are always printed as links.
+type Image uint8
+
+const (
+	// Skip images; nothing is printed.
+	ImageOff Image = iota
+	// Print images as links where they appear, breaking the line around
+	// them.
+	ImageInline
+	// Print images below their paragraph, along with the paragraph's links.
+	// Images outside of paragraphs are printed where they appear.
+	ImageBelow
+)
+
+// Set ImageLabel mode.
+func WithImageLabel(val ImageLabel) Option {
+	return OptionFunc(func(c *Config) {
+		c.ImageLabel = val
+	})
+}
+
+// ImageLabel is an enum config option that controls which text is used to
+// label an image's link.
+type ImageLabel uint8
+
+const (
+	// Label images with their alt text.
+	ImageLabelAlt ImageLabel = iota
+	// Label images with their title, or their alt text if they have no title.
+	ImageLabelTitle
+)
+
+// Set ImagePrefix string. This is printed at the start of every image's label,
+// which makes it easy to tell images apart from other links.
+func WithImagePrefix(val string) Option {
+	return OptionFunc(func(c *Config) {
+		c.ImagePrefix = val
+	})
+}
+
+// Set ImageFallback string. This is used to label images which have no alt
+// text (or title).
+func WithImageFallback(val string) Option {
+	return OptionFunc(func(c *Config) {
+		c.ImageFallback = val
+	})
+}
+
+// Set LinkDedup mode.
+func WithLinkDedup(val LinkDedup) Option {
+	return OptionFunc(func(c *Config) {
+		c.LinkDedup = val
+	})
+}
+
+// LinkDedup is an enum config option that controls whether links with the same
+// destination are printed more than once.
+type LinkDedup uint8
+
+const (
+	// Print every link, even if it was already printed.
+	LinkDedupOff LinkDedup = iota
+	// Print each link once per paragraph.
+	LinkDedupParagraph
+	// Print each link once per heading section.
+	LinkDedupSection
+	// Print each link once in the whole document.
+	LinkDedupDocument
+)
+
+// Set LinkDedupLabel mode.
+func WithLinkDedupLabel(val LinkDedupLabel) Option {
+	return OptionFunc(func(c *Config) {
+		c.LinkDedupLabel = val
+	})
+}
+
+// LinkDedupLabel is an enum config option that controls which label is kept
+// when duplicate links are removed. A link which has already been printed is
+// never changed, so this only applies to links printed together, such as the
+// links below a paragraph.
+type LinkDedupLabel uint8
+
+const (
+	// Keep the label of the first duplicate link.
+	LinkDedupLabelFirst LinkDedupLabel = iota
+	// Keep the label of the last duplicate link.
+	LinkDedupLabelLast
+)
+
+// Set HTML mode.
+func WithHTML(val HTML) Option {
+	return OptionFunc(func(c *Config) {
+		c.HTML = val
+	})
+}
+
+// HTML is an enum config option that controls how html blocks and inline html
+// are printed.
+type HTML uint8
+
+const (
+	// Skip all html.
+	HTMLOff HTML = iota
+	// Convert html into gemtext. Text is kept, links and images become link
+	// lines, line breaks are kept, preformatted text and headings are
+	// converted, and any other tags are stripped.
+	HTMLConvert
+)
+
+// Set FrontMatterTemplate string. Front matter, parsed by the FrontMatter
+// extension, is hidden unless this is set. It's a text/template which is
+// executed with the front matter's fields, for example:
+//
+//	{{with .title}}# {{.}}{{end}}
+//
+//	{{.date}} by {{.author}}
+func WithFrontMatterTemplate(val string) Option {
+	return OptionFunc(func(c *Config) {
+		c.FrontMatterTemplate = val
+	})
+}
+
+// Set TOC mode.
+func WithTOC(val TOC) Option {
+	return OptionFunc(func(c *Config) {
+		c.TOC = val
+	})
+}
+
+// TOC is an enum config option that controls whether a table of contents is
+// printed after the document's first heading.
+type TOC uint8
+
+const (
+	// Don't print a table of contents.
+	TOCOff TOC = iota
+	// Print a table of contents as a list of headings, indented by level.
+	TOCList
+	// Print a table of contents as a list of links to each heading's id.
+	// Useful when the document is split into pages.
+	TOCLinks
+)
+
+// Set TOCDepth int. Headings deeper than this level are left out of the table
+// of contents. A depth of 0 includes every heading.
+func WithTOCDepth(val int) Option {
+	return OptionFunc(func(c *Config) {
+		c.TOCDepth = val
+	})
+}
+
+// Set TOCLabel string. This is printed as a heading above the table of
+// contents. If it's empty no heading is printed.
+func WithTOCLabel(val string) Option {
+	return OptionFunc(func(c *Config) {
+		c.TOCLabel = val
+	})
+}
+
+// Set SplitLevel int. When a document is split into pages, it's split at each
+// heading with a level of at most SplitLevel.
+func WithSplitLevel(val int) Option {
+	return OptionFunc(func(c *Config) {
+		c.SplitLevel = val
+	})
+}
+
+// Set SoftBreak mode.
+func WithSoftBreak(val SoftBreak) Option {
+	return OptionFunc(func(c *Config) {
+		c.SoftBreak = val
+	})
+}
+
+// SoftBreak is an enum config option that controls how soft line breaks, the
+// line breaks within a paragraph, are printed.
+type SoftBreak uint8
+
+const (
+	// Print soft line breaks as a space, joining each paragraph into a
+	// single line.
+	SoftBreakSpace SoftBreak = iota
+	// Print soft line breaks as a newline, keeping the lines of the source.
+	SoftBreakNewline
+	// Print soft line breaks as a newline in blockquotes and as a space
+	// everywhere else.
+	SoftBreakBlockquote
+)
+
+// Set EscapePrefix string. Lines of paragraph text which would be read as a
+// link, heading, list item, quote, or preformatting toggle in gemtext are
+// prefixed with this. If it's empty lines are not escaped.
+func WithEscapePrefix(val string) Option {
+	return OptionFunc(func(c *Config) {
+		c.EscapePrefix = val
+	})
+}
+
+// Set CodeFence mode.
+func WithCodeFence(val CodeFence) Option {
+	return OptionFunc(func(c *Config) {
+		c.CodeFence = val
+	})
+}
+
+// CodeFence is an enum config option that controls how lines of a code block,
+// which begin with a preformatting toggle (```), are rewritten so they don't
+// end the preformatted text early.
+type CodeFence uint8
+
+const (
+	// Indent the line with a space.
+	CodeFenceIndent CodeFence = iota
+	// Prefix the line with a zero width space.
+	CodeFenceZeroWidth
+	// Replace the toggle with CodeFenceSubstitute.
+	CodeFenceReplace
+)
+
+// Set CodeFenceSubstitute string. This replaces preformatting toggles in code
+// blocks when CodeFence is set to CodeFenceReplace.
+func WithCodeFenceSubstitute(val string) Option {
+	return OptionFunc(func(c *Config) {
+		c.CodeFenceSubstitute = val
+	})
+}
+
+// Set Warn func. It's called with a Warning for each problem found in the
+// source which the renderer had to work around.
+func WithWarn(val func(Warning)) Option {
+	return OptionFunc(func(c *Config) {
+		c.Warn = val
+	})
+}
+
+// Set CodeBlockAlt mode.
+func WithCodeBlockAlt(val CodeBlockAlt) Option {
+	return OptionFunc(func(c *Config) {
+		c.CodeBlockAlt = val
+	})
+}
+
+// CodeBlockAlt is an enum config option that controls the alt text printed
+// after the preformatting toggle which opens a code block.
+type CodeBlockAlt uint8
+
+const (
+	// Print the code block's info string as is.
+	CodeBlockAltRaw CodeBlockAlt = iota
+	// Print only the code block's language.
+	CodeBlockAltLanguage
+	// Print the description of the code block's language, from
+	// CodeBlockDescriptions, or the language if it has no description.
+	CodeBlockAltDescription
+	// Print the title or alt attribute of the code block, such as
+	// ```go {title="main.go"}, or the language if it has neither.
+	CodeBlockAltAttribute
+)
+
+// Set CodeBlockDescriptions map. It maps languages to descriptions, which are
+// printed as alt text when CodeBlockAlt is set to CodeBlockAltDescription. For
+// example "go" could be described as "Go source code" for screen readers.
+func WithCodeBlockDescriptions(val map[string]string) Option {
+	return OptionFunc(func(c *Config) {
+		c.CodeBlockDescriptions = val
+	})
+}
+
+// Set CodeBlockAltDefault string. This is printed as alt text for code blocks
+// which have none, such as indented code blocks.
+func WithCodeBlockAltDefault(val string) Option {
+	return OptionFunc(func(c *Config) {
+		c.CodeBlockAltDefault = val
+	})
+}
+
+// Set CodeBlockHandlers map. It maps the languages of fenced code blocks to the
+// CodeBlockHandler used to write them. Code blocks of any other language are
+// printed as preformatted text. The handlers are added to the defaults, which
+// copy gemtext and gmi code blocks into the output as is. Setting a language's
+// handler to nil prints its code blocks as preformatted text again.
+func WithCodeBlockHandlers(val map[string]CodeBlockHandler) Option {
+	return OptionFunc(func(c *Config) {
+		handlers := map[string]CodeBlockHandler{}
+		for language, handler := range c.CodeBlockHandlers {
+			handlers[language] = handler
+		}
+		for language, handler := range val {
+			handlers[language] = handler
+		}
+		c.CodeBlockHandlers = handlers
+	})
+}
@@ -4,10 +4,13 @@ import (
 	"bytes"
 	"fmt"
 	"io"
+	"strings"
+	"sync"
 
 	wast "git.sr.ht/~kota/goldmark-wiki/ast"
 	"github.com/yuin/goldmark/ast"
 	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/renderer"
 	"github.com/yuin/goldmark/util"
 )
@@ -27,9 +30,63 @@ func New(opts ...Option) renderer.Renderer {
 }
 
 // A GemRenderer struct is an implementation of renderer.GemRenderer that renders
-// nodes as gemtext.
+// nodes as gemtext. It's safe to render several documents concurrently.
 type GemRenderer struct {
 	config Config
+
+	// sub is a renderer using this same GemRenderer. It's used to render the
+	// children of nodes such as lists and blockquotes so they share the
+	// configuration of the rest of the document.
+	sub renderer.Renderer
+
+	// documents holds the copy of this renderer used for each document
+	// currently being rendered, keyed by the document. The state below is
+	// only used by those copies.
+	mu        sync.Mutex
+	documents map[ast.Node]*GemRenderer
+
+	// footnotesPrinted holds the index of each footnote which has already
+	// been printed in the document currently being rendered.
+	footnotesPrinted map[int]bool
+
+	// linkNumbers holds the number of each link which has been numbered in
+	// the document currently being rendered and linkCount is the highest
+	// number used so far.
+	linkNumbers map[ast.Node]int
+	linkCount   int
+
+	// linksSeen holds the destination of each link which has been printed,
+	// and numbersSeen the number given to each destination, in the
+	// paragraph, section, or document currently being rendered. They're used
+	// to remove duplicate links.
+	linksSeen   map[string]bool
+	numbersSeen map[string]int
+
+	// tocPrinted is set once the table of contents has been printed.
+	tocPrinted bool
+
+	// sectionEnded is the last node of the heading section which most
+	// recently ended, so a section is never ended twice.
+	sectionEnded ast.Node
+
+	// sectionHTMLLinks holds the links of html converted before an html
+	// heading, which are printed at the end of the section the heading ends.
+	sectionHTMLLinks []link
+
+	// anchors holds the page containing each heading id while a document is
+	// being split into pages.
+	anchors map[string]string
+
+	// hidden holds the nodes of the document currently being rendered which
+	// are left out by conditional directives.
+	hidden map[ast.Node]bool
+
+	// attributes holds the attribute lists found at the end of blocks in the
+	// document currently being rendered, keyed by the block they belong to,
+	// and attributeStarts where each list starts, keyed by the block it's
+	// written in.
+	attributes      map[ast.Node]parser.Attributes
+	attributeStarts map[ast.Node]int
 }
 
 // NewGemRenderer returns a new renderer.NodeRenderer.
@@ -37,6 +94,11 @@ func NewGemRenderer(config *Config) *GemRenderer {
 	r := &GemRenderer{
 		config: *config,
 	}
+	r.sub = renderer.NewRenderer(
+		renderer.WithNodeRenderers(
+			util.Prioritized(r, 1000),
+		),
+	)
 	return r
 }
 
@@ -45,32 +107,266 @@ var _ renderer.NodeRenderer = &GemRenderer{}
 
 // RegisterFuncs implements NodeRenderer.RegisterFuncs.
 func (r *GemRenderer) RegisterFuncs(reg renderer.NodeRendererFuncRegisterer) {
+	// Each document is rendered by its own copy of the renderer, which holds
+	// the state kept while rendering it. Nodes hidden by conditional
+	// directives are skipped.
+	register := func(kind ast.NodeKind, fn nodeRendererFunc) {
+		reg.Register(kind, func(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+			if kind == ast.KindDocument && entering {
+				r.begin(node)
+			}
+			d := r.document(node)
+			if d.hidden[node] {
+				return ast.WalkSkipChildren, nil
+			}
+			status, err := fn(d, w, source, node, entering)
+			if err != nil || kind == ast.KindDocument && !entering {
+				if doc := node.OwnerDocument(); doc != nil {
+					r.end(doc)
+				}
+			}
+			return status, err
+		})
+	}
+
 	// blocks
-	reg.Register(ast.KindDocument, r.renderDocument)
-	reg.Register(ast.KindHeading, r.renderHeading)
-	reg.Register(ast.KindBlockquote, r.renderBlockquote)
-	reg.Register(ast.KindCodeBlock, r.renderCodeBlock)
-	reg.Register(ast.KindFencedCodeBlock, r.renderFencedCodeBlock)
-	reg.Register(ast.KindHTMLBlock, r.renderHTMLBlock)
-	reg.Register(ast.KindList, r.renderList)
-	reg.Register(ast.KindListItem, r.renderListItem)
-	reg.Register(ast.KindParagraph, r.renderParagraph)
-	reg.Register(ast.KindTextBlock, r.renderTextBlock)
-	reg.Register(ast.KindThematicBreak, r.renderThematicBreak)
+	register(ast.KindDocument, (*GemRenderer).renderDocument)
+	register(ast.KindHeading, (*GemRenderer).renderHeading)
+	register(ast.KindBlockquote, (*GemRenderer).renderBlockquote)
+	register(ast.KindCodeBlock, (*GemRenderer).renderCodeBlock)
+	register(ast.KindFencedCodeBlock, (*GemRenderer).renderFencedCodeBlock)
+	register(ast.KindHTMLBlock, (*GemRenderer).renderHTMLBlock)
+	register(KindFrontMatter, (*GemRenderer).renderFrontMatter)
+	register(ast.KindList, (*GemRenderer).renderList)
+	register(ast.KindListItem, (*GemRenderer).renderListItem)
+	register(ast.KindParagraph, (*GemRenderer).renderParagraph)
+	register(ast.KindTextBlock, (*GemRenderer).renderTextBlock)
+	register(ast.KindThematicBreak, (*GemRenderer).renderThematicBreak)
 
 	// inlines
-	reg.Register(ast.KindAutoLink, r.renderAutoLink)
-	reg.Register(ast.KindCodeSpan, r.renderCodeSpan)
-	reg.Register(ast.KindEmphasis, r.renderEmphasis)
-	reg.Register(ast.KindImage, r.renderImage)
-	reg.Register(ast.KindLink, r.renderLink)
-	reg.Register(ast.KindRawHTML, r.renderRawHTML)
-	reg.Register(ast.KindText, r.renderText)
-	reg.Register(ast.KindString, r.renderString)
+	register(ast.KindAutoLink, (*GemRenderer).renderAutoLink)
+	register(ast.KindCodeSpan, (*GemRenderer).renderCodeSpan)
+	register(ast.KindEmphasis, (*GemRenderer).renderEmphasis)
+	register(ast.KindImage, (*GemRenderer).renderImage)
+	register(ast.KindLink, (*GemRenderer).renderLink)
+	register(ast.KindRawHTML, (*GemRenderer).renderRawHTML)
+	register(ast.KindText, (*GemRenderer).renderText)
+	register(ast.KindString, (*GemRenderer).renderString)
 
 	// extras
-	reg.Register(east.KindStrikethrough, r.renderStrikethrough)
-	reg.Register(wast.KindWiki, r.renderWiki)
+	register(east.KindStrikethrough, (*GemRenderer).renderStrikethrough)
+	register(east.KindTable, (*GemRenderer).renderTable)
+	register(east.KindTableHeader, (*GemRenderer).renderTableHeader)
+	register(east.KindTableRow, (*GemRenderer).renderTableRow)
+	register(east.KindTableCell, (*GemRenderer).renderTableCell)
+	register(east.KindFootnoteLink, (*GemRenderer).renderFootnoteLink)
+	register(east.KindFootnoteBacklink, (*GemRenderer).renderFootnoteBacklink)
+	register(east.KindFootnoteList, (*GemRenderer).renderFootnoteList)
+	register(east.KindFootnote, (*GemRenderer).renderFootnote)
+	register(east.KindTaskCheckBox, (*GemRenderer).renderTaskCheckBox)
+	register(east.KindDefinitionList, (*GemRenderer).renderDefinitionList)
+	register(east.KindDefinitionTerm, (*GemRenderer).renderDefinitionTerm)
+	register(east.KindDefinitionDescription, (*GemRenderer).renderDefinitionDescription)
+	register(wast.KindWiki, (*GemRenderer).renderWiki)
+}
+
+// nodeRendererFunc is a renderer.NodeRendererFunc taking the GemRenderer of
+// the document being rendered.
+type nodeRendererFunc func(r *GemRenderer, w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error)
+
+// begin returns a new copy of r to render doc with and keeps it until end is
+// called, so documents can be rendered concurrently.
+func (r *GemRenderer) begin(doc ast.Node) *GemRenderer {
+	d := &GemRenderer{config: r.config, sub: r.sub}
+	d.reset()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.documents == nil {
+		r.documents = map[ast.Node]*GemRenderer{}
+	}
+	r.documents[doc] = d
+	return d
+}
+
+// end forgets the copy of r used to render doc.
+func (r *GemRenderer) end(doc ast.Node) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.documents, doc)
+}
+
+// document returns the copy of r rendering the document containing node. A
+// node outside of any document being rendered gets a new copy.
+func (r *GemRenderer) document(node ast.Node) *GemRenderer {
+	var doc ast.Node
+	if owner := node.OwnerDocument(); owner != nil {
+		doc = owner
+	}
+	r.mu.Lock()
+	d, ok := r.documents[doc]
+	r.mu.Unlock()
+	if !ok {
+		d = &GemRenderer{config: r.config, sub: r.sub}
+		d.reset()
+	}
+	return d
+}
+
+// A Warning describes a problem found while rendering a document which the
+// renderer worked around, but which may need fixing in the source.
+type Warning struct {
+	// Line is the line number, starting from 1, in the source.
+	Line    int
+	Message string
+}
+
+// warn sends a warning to the Warn config option, if it's set.
+func (r *GemRenderer) warn(warning Warning) {
+	if r.config.Warn != nil {
+		r.config.Warn(warning)
+	}
+}
+
+// reset clears the state kept while rendering a document.
+func (r *GemRenderer) reset() {
+	r.footnotesPrinted = map[int]bool{}
+	r.linkNumbers = map[ast.Node]int{}
+	r.linkCount = 0
+	r.linksSeen = map[string]bool{}
+	r.numbersSeen = map[string]int{}
+	r.tocPrinted = false
+	r.sectionEnded = nil
+	r.sectionHTMLLinks = nil
+	r.anchors = nil
+	r.hidden = nil
+	r.attributes = nil
+	r.attributeStarts = nil
+}
+
+// prepare finds the attribute lists and conditional directives in a document
+// before it's rendered. Blocks with a "gemini=skip" attribute and nodes
+// holding only an attribute list are hidden along with web only content.
+func (r *GemRenderer) prepare(source []byte, doc ast.Node) {
+	var lists map[ast.Node]bool
+	r.attributes, r.attributeStarts, lists = blockAttributes(source, doc)
+	r.hidden = hiddenNodes(source, doc)
+	_ = ast.Walk(doc, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if value, _ := r.attribute(n, "gemini"); entering && value == "skip" {
+			r.hidden[n] = true
+		}
+		return ast.WalkContinue, nil
+	})
+	for n := range lists {
+		r.hidden[n] = true
+	}
+}
+
+// render is a helper function that renders a node, and its children, to a
+// writer using the same configuration as r.
+func (r *GemRenderer) render(w io.Writer, source []byte, node ast.Node) error {
+	return r.sub.Render(w, source, node)
+}
+
+// sectionEnd is called before each heading and at the end of the document
+// with the last node in the heading section which just ended, or nil if the
+// section is empty. It prints the content which is deferred until the end of
+// a section.
+func (r *GemRenderer) sectionEnd(w util.BufWriter, source []byte, last ast.Node) error {
+	if last != nil && last == r.sectionEnded {
+		return nil
+	}
+	r.sectionEnded = last
+
+	// Find the start of the section. An html block with a heading begins
+	// the section with the html after its last heading.
+	var first ast.Node
+	for n := last; n != nil && (n.Kind() != ast.KindHeading || r.hidden[n]); n = n.PreviousSibling() {
+		first = n
+		if r.htmlSectionStart(source, n) {
+			break
+		}
+	}
+	htmlLinks := r.sectionHTMLLinks
+	r.sectionHTMLLinks = nil
+	if first == nil && len(htmlLinks) == 0 {
+		return nil
+	}
+
+	if r.config.ParagraphLink == ParagraphLinkSection {
+		links := append(htmlLinks, r.sectionLinks(source, first, last)...)
+		if linksPrint(w, r.dedup(links)) {
+			fmt.Fprintf(w, "\n")
+		}
+	}
+	if r.config.Footnote == FootnoteSection && first != nil {
+		if err := r.footnoteSection(w, source, first, last); err != nil {
+			return err
+		}
+	}
+
+	// Duplicate links may be printed again in the next section.
+	if r.config.LinkDedup == LinkDedupSection {
+		r.linksSeen = map[string]bool{}
+		r.numbersSeen = map[string]int{}
+	}
+	return nil
+}
+
+// sectionLinks is a helper function that returns every link found in the
+// nodes from first to last, and their children. Links in headings and link
+// only paragraphs are left out, since they're printed where they appear.
+func (r *GemRenderer) sectionLinks(source []byte, first, last ast.Node) []link {
+	var links []link
+	for n := first; n != nil; n = n.NextSibling() {
+		_ = ast.Walk(n, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+			if !entering {
+				return ast.WalkContinue, nil
+			}
+			if r.hidden[n] {
+				return ast.WalkSkipChildren, nil
+			}
+			switch n.Kind() {
+			case ast.KindHeading:
+				return ast.WalkSkipChildren, nil
+			case ast.KindHTMLBlock:
+				if r.config.HTML == HTMLConvert {
+					// Only the html after the block's last heading is in
+					// the section.
+					var blockLinks []link
+					for _, b := range r.htmlBlocks(htmlBlockText(source, n.(*ast.HTMLBlock))) {
+						switch {
+						case b.heading > 0:
+							blockLinks = nil
+						case !b.linkOnly:
+							blockLinks = append(blockLinks, b.links...)
+						}
+					}
+					links = append(links, blockLinks...)
+				}
+				return ast.WalkSkipChildren, nil
+			case ast.KindLink, ast.KindAutoLink, wast.KindWiki, ast.KindRawHTML:
+				parent := n.Parent()
+				if parent.Kind() == ast.KindParagraph && linkOnly(source, parent) {
+					return ast.WalkSkipChildren, nil
+				}
+				// List items holding only links print them in place.
+				if item := parent.Parent(); item != nil && item.Kind() == ast.KindListItem {
+					if links, _ := r.listItemLinks(source, item); links != nil {
+						return ast.WalkSkipChildren, nil
+					}
+				}
+				if l, ok := r.link(source, n, ""); ok {
+					links = append(links, l)
+				}
+				return ast.WalkSkipChildren, nil
+			}
+			return ast.WalkContinue, nil
+		})
+		if n == last {
+			break
+		}
+	}
+	return links
 }
 
 // linkOnly is a helper function that returns true is a node's subnodes have
@@ -100,62 +396,272 @@ func linkOnly(source []byte, node ast.Node) bool {
 	return false
 }
 
+// numbered returns true if a link is marked with its number in the text, which
+// is done for links in paragraphs, tight list items, table cells, and
+// definition lists when using ParagraphLinkNumberedBelow.
+func (r *GemRenderer) numbered(node ast.Node) bool {
+	if r.config.ParagraphLink != ParagraphLinkNumberedBelow {
+		return false
+	}
+	switch node.Parent().Kind() {
+	case ast.KindParagraph, ast.KindTextBlock, east.KindTableCell, east.KindDefinitionTerm:
+		return true
+	}
+	return false
+}
+
+// linkNumber returns the number of a link. Links are numbered in the order
+// they're first seen, continuously across the whole document. When duplicate
+// links are removed, links with the same destination share a number.
+func (r *GemRenderer) linkNumber(source []byte, node ast.Node) int {
+	if r.linkNumbers == nil {
+		r.linkNumbers = map[ast.Node]int{}
+	}
+	if number, ok := r.linkNumbers[node]; ok {
+		return number
+	}
+
+	destination, _ := r.destination(source, node)
+	number := r.destinationNumber(destination)
+	r.linkNumbers[node] = number
+	return number
+}
+
+// destinationNumber returns the next link number. When duplicate links are
+// removed, the number already given to the destination is returned instead.
+func (r *GemRenderer) destinationNumber(destination string) int {
+	if r.config.LinkDedup != LinkDedupOff {
+		if r.numbersSeen == nil {
+			r.numbersSeen = map[string]int{}
+		}
+		if number, ok := r.numbersSeen[destination]; ok {
+			return number
+		}
+	}
+	r.linkCount++
+	if r.config.LinkDedup != LinkDedupOff {
+		r.numbersSeen[destination] = r.linkCount
+	}
+	return r.linkCount
+}
+
+// linkOnly is like the linkOnly helper function, but when images are printed
+// below paragraphs they are also treated as links.
+func (r *GemRenderer) linkOnly(source []byte, node ast.Node) bool {
+	if linkOnly(source, node) {
+		return true
+	}
+	return r.config.Image == ImageBelow && imageOnly(source, node)
+}
+
+// imageOnly is a helper function that returns true if a node's subnodes have
+// images and don't have text or links.
+func imageOnly(source []byte, node ast.Node) bool {
+	var hasImage bool = false
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		switch nl := child.(type) {
+		case *ast.Image:
+			hasImage = true
+		case *ast.Link, *ast.AutoLink, *wast.Wiki:
+			return false
+		case *ast.Text:
+			if string(nl.Segment.Value(source)) != "" {
+				return false
+			}
+		}
+	}
+	return hasImage
+}
+
+// link is a single gemtext link line.
+type link struct {
+	destination string
+	label       string
+}
+
+// String returns the link as a line of gemtext, without a trailing newline.
+func (l link) String() string {
+	if l.label == "" {
+		return "=> " + l.destination
+	}
+	return "=> " + l.destination + " " + l.label
+}
+
+// linksPrint is a helper function that prints a list of links, each followed
+// by a newline. Returns false if there were no links to print.
+func linksPrint(w io.Writer, links []link) bool {
+	for _, l := range links {
+		fmt.Fprintf(w, "%s\n", l)
+	}
+	return len(links) > 0
+}
+
 // linkPrint is a helper function that prints a link's text to a writer, applies
-// any regex replacers. Images are not handled by this function as they operate
-// slightly differently. Format can be used to format the link text.
+// the configured regex replacers. Images are not handled by this function as
+// they operate slightly differently. Format can be used to format the link
+// text.
 // Returns false if a link was not printed.
-func linkPrint(w io.Writer, source []byte, node ast.Node, replacers []LinkReplacer, format string) bool {
+func (r *GemRenderer) linkPrint(w io.Writer, source []byte, node ast.Node, format string) bool {
+	l, ok := r.link(source, node, format)
+	if !ok {
+		return false
+	}
+	fmt.Fprintf(w, "%s", l)
+	return true
+}
+
+// link is a helper function that returns a link's destination, with the
+// configured regex replacers applied, and its text formatted with format.
+// Returns false if node is not a link.
+func (r *GemRenderer) link(source []byte, node ast.Node, format string) (link, bool) {
 	if format == "" {
 		format = "%s"
 	}
-	// I know the logic is nearly duplicated in *ast.Link and *wast.Wiki, but I
-	// don't know of a good way to consolidate this. You _can_ match multiple
-	// types in a type switch, but instead of n being the correct type it will
-	// be assigned interface{}. So you would need to do additional type
-	// assertions and that seems worse than a little duplication.
+	destination, ok := r.destination(source, node)
+	if !ok {
+		return link{}, false
+	}
 	switch n := node.(type) {
-	case *ast.Link:
-		// Apply link replacers.
-		destination := n.Destination
-		for _, r := range replacers {
-			s := r.replace(string(destination), LinkMarkdown)
-			destination = []byte(s)
-		}
-
+	case *ast.Link, *wast.Wiki:
 		// Get link text.
-		text, err := nodeText(source, n)
+		text, err := r.nodeText(source, n)
 		if err != nil {
-			return false
+			return link{}, false
 		}
-		fmt.Fprintf(w, "=> %s %s", destination, fmt.Sprintf(format, text))
-		return true
-	case *wast.Wiki:
-		// Apply link replacers.
-		destination := n.Destination
-		for _, r := range replacers {
-			s := r.replace(string(destination), LinkWiki)
-			destination = []byte(s)
+		return link{destination, fmt.Sprintf(format, text)}, true
+	case *ast.AutoLink:
+		return link{destination: destination}, true
+	case *ast.RawHTML:
+		// Images are not formatted, just like images in paragraphs.
+		if tag, _ := rawHTMLTag(source, n); tag.name == "img" {
+			format = "%s"
 		}
+		return link{destination, fmt.Sprintf(format, r.rawHTMLLabel(source, n))}, true
+	}
+	return link{}, false
+}
 
-		// Get link text.
-		text, err := nodeText(source, n)
-		if err != nil {
-			return false
+// destination is a helper function that returns the destination of a link or
+// image with the configured regex replacers applied. Returns false if node is
+// not a link or image.
+func (r *GemRenderer) destination(source []byte, node ast.Node) (string, bool) {
+	var destination string
+	var t LinkType
+	switch n := node.(type) {
+	case *ast.Link:
+		destination, t = string(n.Destination), LinkMarkdown
+	case *wast.Wiki:
+		destination, t = string(n.Destination), LinkWiki
+	case *ast.AutoLink:
+		destination, t = string(n.Label(source)), LinkAuto
+	case *ast.Image:
+		destination, t = string(n.Destination), LinkImage
+	case *ast.RawHTML:
+		if r.config.HTML == HTMLOff {
+			return "", false
 		}
+		tag, ok := rawHTMLTag(source, n)
+		switch {
+		case !ok || tag.kind != htmlStartTag:
+			return "", false
+		case tag.name == "a" && tag.attrs["href"] != "":
+			destination, t = tag.attrs["href"], LinkMarkdown
+		case tag.name == "img" && tag.attrs["src"] != "" && r.config.Image != ImageOff:
+			destination, t = tag.attrs["src"], LinkImage
+		default:
+			return "", false
+		}
+	default:
+		return "", false
+	}
 
-		fmt.Fprintf(w, "=> %s %s", destination, fmt.Sprintf(format, text))
-		return true
-	case *ast.AutoLink:
-		// Apply link replacers.
-		destination := n.Label(source)
-		for _, r := range replacers {
-			s := r.replace(string(destination), LinkAuto)
-			destination = []byte(s)
+	// Links to headings point to the page containing the heading when the
+	// document is split into pages.
+	if strings.HasPrefix(destination, "#") {
+		destination = r.anchor(destination[1:])
+	}
+	return r.replaceLinks(destination, t), true
+}
+
+// replaceLinks is a helper function that applies the configured regex
+// replacers to a link destination of the given type.
+func (r *GemRenderer) replaceLinks(destination string, t LinkType) string {
+	for _, rep := range r.config.LinkReplacers {
+		destination = rep.replace(destination, t)
+	}
+	return destination
+}
+
+// imagePrint is a helper function that prints an image as a link, applies the
+// configured regex replacers, and labels it based on the image config options.
+// Returns false if the image was not printed.
+func (r *GemRenderer) imagePrint(w io.Writer, source []byte, n *ast.Image) bool {
+	l, ok := r.image(source, n)
+	if !ok {
+		return false
+	}
+	fmt.Fprintf(w, "%s", l)
+	return true
+}
+
+// image is a helper function that returns an image as a link, labeled based on
+// the image config options.
+func (r *GemRenderer) image(source []byte, n *ast.Image) (link, bool) {
+	destination, _ := r.destination(source, n)
+
+	// Get image label.
+	alt, err := r.nodeText(source, n)
+	if err != nil {
+		return link{}, false
+	}
+	return link{destination, r.imageLabel(string(alt), string(n.Title))}, true
+}
+
+// imageLabel is a helper function that returns the label of an image, given
+// its alt text and title, based on the image config options.
+func (r *GemRenderer) imageLabel(alt, title string) string {
+	label := alt
+	if r.config.ImageLabel == ImageLabelTitle && title != "" {
+		label = title
+	}
+	if label == "" {
+		label = r.config.ImageFallback
+	}
+	return strings.TrimSpace(r.config.ImagePrefix + label)
+}
+
+// dedup removes duplicate links, which have the same destination, based on the
+// LinkDedup config option. Links which were already printed earlier in the
+// paragraph, section, or document are removed. The label of the first or last
+// duplicate is kept, but only among the links printed together; a link which
+// was already printed is never changed.
+func (r *GemRenderer) dedup(links []link) []link {
+	if r.config.LinkDedup == LinkDedupOff {
+		return links
+	}
+	if r.config.LinkDedup == LinkDedupParagraph || r.linksSeen == nil {
+		r.linksSeen = map[string]bool{}
+	}
+
+	var deduped []link
+	index := map[string]int{}
+	for _, l := range links {
+		if i, ok := index[l.destination]; ok {
+			if r.config.LinkDedupLabel == LinkDedupLabelLast {
+				deduped[i].label = l.label
+			}
+			continue
 		}
-		fmt.Fprintf(w, "=> %s", destination)
-		return true
+		if r.linksSeen[l.destination] {
+			continue
+		}
+		index[l.destination] = len(deduped)
+		deduped = append(deduped, l)
 	}
-	return false
+	for _, l := range deduped {
+		r.linksSeen[l.destination] = true
+	}
+	return deduped
 }
 
 // replace applies a LinkReplacer if the type matches t. The string returned
@@ -167,17 +673,83 @@ func (r LinkReplacer) replace(s string, t LinkType) string {
 	return s
 }
 
-// nodeText is a helper function that recursively creates and runs a renderer
-// for a specific node. This is slower, but is the only way to handle some link
-// text edge cases (multiline links, emphasis markings in link test, etc).
-func nodeText(source []byte, node ast.Node) ([]byte, error) {
+// lineTypes are the beginnings of gemtext lines which are not text lines.
+var lineTypes = [][]byte{
+	[]byte("=>"),
+	[]byte("#"),
+	[]byte("* "),
+	[]byte(">"),
+	[]byte("```"),
+}
+
+// escape is a helper function that prefixes each line of text, which would be
+// read as another type of gemtext line, with the EscapePrefix config option.
+// Lines starting within one of the skipped ranges of text are left alone.
+func (r *GemRenderer) escape(text []byte, skip ...[2]int) []byte {
+	if r.config.EscapePrefix == "" {
+		return text
+	}
+	var buf bytes.Buffer
+	var offset int
+lines:
+	for _, line := range bytes.SplitAfter(text, []byte{'\n'}) {
+		start := offset
+		offset += len(line)
+		for _, s := range skip {
+			if start >= s[0] && start < s[1] {
+				buf.Write(line)
+				continue lines
+			}
+		}
+		for _, t := range lineTypes {
+			if bytes.HasPrefix(line, t) {
+				buf.WriteString(r.config.EscapePrefix)
+				break
+			}
+		}
+		buf.Write(line)
+	}
+	return buf.Bytes()
+}
+
+// nodeText is a helper function that recursively renders the children of a
+// specific node. This is slower, but is the only way to handle some link text
+// edge cases (multiline links, emphasis markings in link test, etc).
+func (r *GemRenderer) nodeText(source []byte, node ast.Node) ([]byte, error) {
 	var buf bytes.Buffer
 	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
-		sub := New()
-		if err := sub.Render(&buf, source, child); err != nil {
+		if err := r.render(&buf, source, child); err != nil {
 			return nil, err
 		}
 	}
 	text := bytes.TrimSpace(buf.Bytes())
 	return text, nil
 }
+
+// inlineText is a helper function that returns the rendered text of a node
+// containing inlines. Links do not print their labels if their parent contains
+// only links, so in that case the labels are collected here instead.
+func (r *GemRenderer) inlineText(source []byte, node ast.Node) ([]byte, error) {
+	if !linkOnly(source, node) {
+		return r.nodeText(source, node)
+	}
+	var labels [][]byte
+	for child := node.FirstChild(); child != nil; child = child.NextSibling() {
+		switch nl := child.(type) {
+		case *ast.Link, *wast.Wiki:
+			text, err := r.nodeText(source, nl)
+			if err != nil {
+				return nil, err
+			}
+			// Table cells aren't printed as link lines, so their links
+			// are numbered like any other.
+			if node.Kind() == east.KindTableCell && r.numbered(nl) {
+				text = append(text, fmt.Sprintf("[%d]", r.linkNumber(source, nl))...)
+			}
+			labels = append(labels, text)
+		case *ast.AutoLink:
+			labels = append(labels, nl.Label(source))
+		}
+	}
+	return bytes.Join(labels, []byte(" ")), nil
+}
@@ -3,15 +3,20 @@ package gemtext
 import (
 	"bytes"
 	"fmt"
+	"io"
 	"os"
+	"path/filepath"
 	"regexp"
+	"sync"
 	"testing"
 
 	wiki "git.sr.ht/~kota/goldmark-wiki"
 	"github.com/google/go-cmp/cmp"
 	"github.com/yuin/goldmark"
 	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
 	"github.com/yuin/goldmark/renderer"
+	"github.com/yuin/goldmark/text"
 	"github.com/yuin/goldmark/util"
 )
 
@@ -40,6 +45,35 @@ func TestNew(t *testing.T) {
 			"test_data/render.md", "test_data/renderHeadingSpaceSingle.gmi",
 			WithHeadingSpace(HeadingSpaceSingle),
 		},
+		{
+			"test_data/render.md", "test_data/renderHeadingLevelText.gmi",
+			WithHeadingLevel(HeadingLevelText),
+		},
+		{
+			"test_data/render.md", "test_data/renderHeadingLevelUnicode.gmi",
+			WithHeadingLevel(HeadingLevelUnicode),
+		},
+		{
+			"test_data/render.md", "test_data/renderHeadingMarker.gmi",
+			OptionFunc(func(c *Config) {
+				c.HeadingLevel = HeadingLevelText
+				c.HeadingMarker = "» "
+			}),
+		},
+		{
+			"test_data/render.md", "test_data/renderHeadingOffset.gmi",
+			OptionFunc(func(c *Config) {
+				c.HeadingLevel = HeadingLevelOffset
+				c.HeadingOffset = 3
+			}),
+		},
+		{
+			"test_data/render.md", "test_data/renderHeadingOffsetOne.gmi",
+			OptionFunc(func(c *Config) {
+				c.HeadingLevel = HeadingLevelOffset
+				c.HeadingOffset = 1
+			}),
+		},
 		{
 			"test_data/render.md", "test_data/renderParagraphLinkOff.gmi",
 			WithParagraphLink(ParagraphLinkOff),
@@ -48,6 +82,25 @@ func TestNew(t *testing.T) {
 			"test_data/render.md", "test_data/renderParagraphLinkCurlyBelow.gmi",
 			WithParagraphLink(ParagraphLinkCurlyBelow),
 		},
+		{
+			"test_data/render.md", "test_data/renderParagraphLinkNumberedBelow.gmi",
+			WithParagraphLink(ParagraphLinkNumberedBelow),
+		},
+		{
+			"test_data/render.md", "test_data/renderParagraphLinkSection.gmi",
+			WithParagraphLink(ParagraphLinkSection),
+		},
+		{
+			"test_data/section.md", "test_data/renderSectionLinks.gmi",
+			WithParagraphLink(ParagraphLinkSection),
+		},
+		{
+			"test_data/section.md", "test_data/renderSectionLinksFootnotes.gmi",
+			OptionFunc(func(c *Config) {
+				c.ParagraphLink = ParagraphLinkSection
+				c.Footnote = FootnoteSection
+			}),
+		},
 
 		{
 			"test_data/render.md", "test_data/renderHeadLinkOff.gmi",
@@ -81,6 +134,14 @@ func TestNew(t *testing.T) {
 			"test_data/render.md", "test_data/renderHorizontalRule.gmi",
 			WithHorizontalRule("+++"),
 		},
+		{
+			"test_data/render.md", "test_data/renderOrderedListOff.gmi",
+			WithOrderedList(OrderedListOff),
+		},
+		{
+			"test_data/render.md", "test_data/renderOrderedListBullet.gmi",
+			WithOrderedList(OrderedListBullet),
+		},
 		{
 			"test_data/render.md", "test_data/renderLinkReplacers.gmi",
 			WithLinkReplacers([]LinkReplacer{
@@ -106,6 +167,310 @@ func TestNew(t *testing.T) {
 				},
 			}),
 		},
+		{
+			"test_data/image.md", "test_data/renderImageInline.gmi",
+			WithImage(ImageInline),
+		},
+		{
+			"test_data/image.md", "test_data/renderImageBelow.gmi",
+			WithImage(ImageBelow),
+		},
+		{
+			"test_data/image.md", "test_data/renderImageOff.gmi",
+			WithImage(ImageOff),
+		},
+		{
+			"test_data/image.md", "test_data/renderImageLabelTitle.gmi",
+			WithImageLabel(ImageLabelTitle),
+		},
+		{
+			"test_data/image.md", "test_data/renderImagePrefix.gmi",
+			OptionFunc(func(c *Config) {
+				c.Image = ImageBelow
+				c.ImagePrefix = "🖼 "
+				c.ImageFallback = "Untitled image"
+			}),
+		},
+		{
+			"test_data/dedup.md", "test_data/renderLinkDedupOff.gmi",
+			WithLinkDedup(LinkDedupOff),
+		},
+		{
+			"test_data/dedup.md", "test_data/renderLinkDedupParagraph.gmi",
+			WithLinkDedup(LinkDedupParagraph),
+		},
+		{
+			"test_data/dedup.md", "test_data/renderLinkDedupSection.gmi",
+			WithLinkDedup(LinkDedupSection),
+		},
+		{
+			"test_data/dedup.md", "test_data/renderLinkDedupDocument.gmi",
+			WithLinkDedup(LinkDedupDocument),
+		},
+		{
+			"test_data/dedup.md", "test_data/renderLinkDedupLabelLast.gmi",
+			OptionFunc(func(c *Config) {
+				c.LinkDedup = LinkDedupParagraph
+				c.LinkDedupLabel = LinkDedupLabelLast
+			}),
+		},
+		{
+			"test_data/dedup.md", "test_data/renderLinkDedupNumbered.gmi",
+			OptionFunc(func(c *Config) {
+				c.LinkDedup = LinkDedupDocument
+				c.ParagraphLink = ParagraphLinkNumberedBelow
+			}),
+		},
+		{
+			"test_data/dedup.md", "test_data/renderLinkDedupSectionLinks.gmi",
+			OptionFunc(func(c *Config) {
+				c.LinkDedup = LinkDedupSection
+				c.ParagraphLink = ParagraphLinkSection
+			}),
+		},
+		{
+			"test_data/html.md", "test_data/renderHTMLOff.gmi",
+			WithHTML(HTMLOff),
+		},
+		{
+			"test_data/html.md", "test_data/renderHTMLConvert.gmi",
+			WithHTML(HTMLConvert),
+		},
+		{
+			"test_data/html.md", "test_data/renderHTMLNumbered.gmi",
+			OptionFunc(func(c *Config) {
+				c.HTML = HTMLConvert
+				c.ParagraphLink = ParagraphLinkNumberedBelow
+			}),
+		},
+		{
+			"test_data/html.md", "test_data/renderHTMLSectionLinks.gmi",
+			OptionFunc(func(c *Config) {
+				c.HTML = HTMLConvert
+				c.ParagraphLink = ParagraphLinkSection
+			}),
+		},
+		{
+			"test_data/html.md", "test_data/renderHTMLHeadingLevelText.gmi",
+			OptionFunc(func(c *Config) {
+				c.HTML = HTMLConvert
+				c.HeadingLevel = HeadingLevelText
+				c.HeadingMarker = "> "
+				c.CodeFence = CodeFenceReplace
+			}),
+		},
+		{
+			"test_data/frontmatter.md", "test_data/renderFrontMatter.gmi",
+			WithFrontMatterTemplate(""),
+		},
+		{
+			"test_data/frontmatter.md", "test_data/renderFrontMatterTemplate.gmi",
+			WithFrontMatterTemplate("# {{.title}}\n\n{{.date}} by {{.author}}{{.missing}}"),
+		},
+		{
+			"test_data/frontmatter_toml.md", "test_data/renderFrontMatterTOML.gmi",
+			WithFrontMatterTemplate("# {{.title}}\n\n{{.date}}{{with .author}} by {{.}}{{end}}"),
+		},
+		{
+			"test_data/frontmatter_unclosed.md", "test_data/renderFrontMatterUnclosed.gmi",
+			WithFrontMatterTemplate("# {{.title}}"),
+		},
+		{
+			"test_data/frontmatter_breaks.md", "test_data/renderFrontMatterBreaks.gmi",
+			WithFrontMatterTemplate("# {{.title}}"),
+		},
+		{
+			"test_data/toc.md", "test_data/renderTOCOff.gmi",
+			WithTOC(TOCOff),
+		},
+		{
+			"test_data/toc.md", "test_data/renderTOCList.gmi",
+			WithTOC(TOCList),
+		},
+		{
+			"test_data/toc.md", "test_data/renderTOCLinks.gmi",
+			WithTOC(TOCLinks),
+		},
+		{
+			"test_data/toc.md", "test_data/renderTOCDepth.gmi",
+			OptionFunc(func(c *Config) {
+				c.TOC = TOCList
+				c.TOCDepth = 0
+				c.TOCLabel = ""
+			}),
+		},
+		{
+			"test_data/softbreak.md", "test_data/renderSoftBreakSpace.gmi",
+			WithSoftBreak(SoftBreakSpace),
+		},
+		{
+			"test_data/softbreak.md", "test_data/renderSoftBreakNewline.gmi",
+			WithSoftBreak(SoftBreakNewline),
+		},
+		{
+			"test_data/softbreak.md", "test_data/renderSoftBreakBlockquote.gmi",
+			WithSoftBreak(SoftBreakBlockquote),
+		},
+		{
+			"test_data/escape.md", "test_data/renderEscape.gmi",
+			WithEscapePrefix(EscapePrefix),
+		},
+		{
+			"test_data/escape.md", "test_data/renderEscapeOff.gmi",
+			WithEscapePrefix(""),
+		},
+		{
+			"test_data/escape.md", "test_data/renderEscapePrefix.gmi",
+			WithEscapePrefix("\\"),
+		},
+		{
+			"test_data/codefence.md", "test_data/renderCodeFenceIndent.gmi",
+			WithCodeFence(CodeFenceIndent),
+		},
+		{
+			"test_data/codefence.md", "test_data/renderCodeFenceZeroWidth.gmi",
+			WithCodeFence(CodeFenceZeroWidth),
+		},
+		{
+			"test_data/codefence.md", "test_data/renderCodeFenceReplace.gmi",
+			WithCodeFence(CodeFenceReplace),
+		},
+		{
+			"test_data/codealt.md", "test_data/renderCodeBlockAltRaw.gmi",
+			WithCodeBlockAlt(CodeBlockAltRaw),
+		},
+		{
+			"test_data/codealt.md", "test_data/renderCodeBlockAltLanguage.gmi",
+			WithCodeBlockAlt(CodeBlockAltLanguage),
+		},
+		{
+			"test_data/codealt.md", "test_data/renderCodeBlockAltDescription.gmi",
+			OptionFunc(func(c *Config) {
+				c.CodeBlockAlt = CodeBlockAltDescription
+				c.CodeBlockDescriptions = map[string]string{"go": "Go source code"}
+				c.CodeBlockAltDefault = "Code"
+			}),
+		},
+		{
+			"test_data/codealt.md", "test_data/renderCodeBlockAltAttribute.gmi",
+			WithCodeBlockAlt(CodeBlockAltAttribute),
+		},
+		{
+			"test_data/codehandler.md", "test_data/renderCodeBlockHandlers.gmi",
+			OptionFunc(func(c *Config) {
+				c.CodeBlockAlt = CodeBlockAltAttribute
+				c.CodeBlockHandlers = map[string]CodeBlockHandler{
+					"gemtext": CodeBlockVerbatim,
+					"csv":     CodeBlockCSV(),
+					"mermaid": CodeBlockDescription,
+				}
+			}),
+		},
+		{
+			"test_data/codehandler.md", "test_data/renderCodeBlockHandlersRowList.gmi",
+			WithCodeBlockHandlers(map[string]CodeBlockHandler{
+				"csv": CodeBlockCSV(WithTable(TableRowList)),
+			}),
+		},
+		{
+			"test_data/codehandler.md", "test_data/renderCodeBlockHandlersNil.gmi",
+			WithCodeBlockHandlers(map[string]CodeBlockHandler{
+				"gemtext": nil,
+				"csv":     nil,
+			}),
+		},
+		{
+			"test_data/passthrough.md", "test_data/renderPassthrough.gmi",
+			WithHTML(HTMLOff),
+		},
+		{
+			"test_data/passthrough.md", "test_data/renderPassthroughHTML.gmi",
+			WithHTML(HTMLConvert),
+		},
+		{
+			"test_data/conditional.md", "test_data/renderConditional.gmi",
+			WithParagraphLink(ParagraphLinkBelow),
+		},
+		{
+			"test_data/conditional.md", "test_data/renderConditionalSection.gmi",
+			OptionFunc(func(c *Config) {
+				c.ParagraphLink = ParagraphLinkSection
+				c.HTML = HTMLConvert
+				c.TOC = TOCList
+			}),
+		},
+		{
+			"test_data/attributes.md", "test_data/renderAttributes.gmi",
+			WithTOC(TOCLinks),
+		},
+		{
+			"test_data/listlinks.md", "test_data/renderListLinks.gmi",
+			WithParagraphLink(ParagraphLinkBelow),
+		},
+		{
+			"test_data/listlinks.md", "test_data/renderListLinksSection.gmi",
+			WithParagraphLink(ParagraphLinkSection),
+		},
+		{
+			"test_data/listlinks.md", "test_data/renderListLinksNumbered.gmi",
+			WithParagraphLink(ParagraphLinkNumberedBelow),
+		},
+		{
+			"test_data/table.md", "test_data/renderTableNumbered.gmi",
+			WithParagraphLink(ParagraphLinkNumberedBelow),
+		},
+		{
+			"test_data/table.md", "test_data/renderTable.gmi",
+			WithParagraphLink(ParagraphLinkBelow),
+		},
+		{
+			"test_data/table.md", "test_data/renderTableOff.gmi",
+			WithTable(TableOff),
+		},
+		{
+			"test_data/table.md", "test_data/renderTableRowList.gmi",
+			WithTable(TableRowList),
+		},
+		{
+			"test_data/table.md", "test_data/renderTableWidth.gmi",
+			WithTableWidth(40),
+		},
+		{
+			"test_data/footnote.md", "test_data/renderFootnoteDocument.gmi",
+			WithFootnote(FootnoteDocument),
+		},
+		{
+			"test_data/footnote.md", "test_data/renderFootnoteSection.gmi",
+			WithFootnote(FootnoteSection),
+		},
+		{
+			"test_data/tasklist.md", "test_data/renderTaskListOff.gmi",
+			WithTaskList(TaskListOff),
+		},
+		{
+			"test_data/tasklist.md", "test_data/renderTaskListMarkdown.gmi",
+			WithTaskList(TaskListMarkdown),
+		},
+		{
+			"test_data/tasklist.md", "test_data/renderTaskListUnicode.gmi",
+			WithTaskList(TaskListUnicode),
+		},
+		{
+			"test_data/definitionlist.md", "test_data/renderDefinitionListList.gmi",
+			WithDefinitionList(DefinitionListList),
+		},
+		{
+			"test_data/definitionlist.md", "test_data/renderDefinitionListQuote.gmi",
+			WithDefinitionList(DefinitionListQuote),
+		},
+		{
+			"test_data/definitionlist.md", "test_data/renderDefinitionListHeading.gmi",
+			WithDefinitionList(DefinitionListHeading),
+		},
+		{
+			"test_data/definitionlist.md", "test_data/renderDefinitionListLinkOff.gmi",
+			WithParagraphLink(ParagraphLinkOff),
+		},
 	}
 
 	for _, test := range tests {
@@ -120,6 +485,11 @@ func TestNew(t *testing.T) {
 				wiki.Wiki,
 				extension.Linkify,
 				extension.Strikethrough,
+				extension.Table,
+				extension.Footnote,
+				extension.TaskList,
+				extension.DefinitionList,
+				FrontMatter,
 			),
 		)
 
@@ -150,7 +520,7 @@ func TestNewGemRenderer(t *testing.T) {
 	}{
 		{
 			"test_data/render.md", "test_data/renderDefault.gmi",
-			Config{HeadingLinkAuto, HeadingSpaceDouble, ParagraphLinkBelow, EmphasisOff, StrikethroughOff, CodeSpanOff, HR, []LinkReplacer{}},
+			Config{HeadingLinkAuto, HeadingSpaceDouble, HeadingLevelClamp, HeadingMarker, 0, ParagraphLinkBelow, EmphasisOff, StrikethroughOff, CodeSpanOff, HR, []LinkReplacer{}, TablePreformatted, TableWidth, FootnoteDocument, TaskListMarkdown, DefinitionListList, OrderedListText, ImageInline, ImageLabelAlt, "", "", LinkDedupOff, LinkDedupLabelFirst, HTMLOff, "", TOCOff, TOCDepth, TOCLabel, SplitLevel, SoftBreakSpace, EscapePrefix, CodeFenceIndent, CodeFenceSubstitute, nil, CodeBlockAltRaw, map[string]string{}, "", map[string]CodeBlockHandler{"gemtext": CodeBlockVerbatim, "gmi": CodeBlockVerbatim}},
 		},
 	}
 
@@ -165,6 +535,11 @@ func TestNewGemRenderer(t *testing.T) {
 				wiki.Wiki,
 				extension.Linkify,
 				extension.Strikethrough,
+				extension.Table,
+				extension.Footnote,
+				extension.TaskList,
+				extension.DefinitionList,
+				FrontMatter,
 			),
 		)
 
@@ -190,3 +565,200 @@ func TestNewGemRenderer(t *testing.T) {
 		}
 	}
 }
+
+// TestParserAttribute renders a document whose heading attributes are parsed
+// by goldmark instead of the GemRenderer.
+func TestParserAttribute(t *testing.T) {
+	src, want, err := setupFiles("test_data/attributes.md", "test_data/renderParserAttributes.gmi")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	md := goldmark.New(
+		goldmark.WithExtensions(extension.Table),
+		goldmark.WithParserOptions(parser.WithAttribute()),
+	)
+	md.SetRenderer(New(WithTOC(TOCLinks)))
+	if err := md.Convert(src, &buf); err != nil {
+		t.Fatal(err)
+	}
+	got := buf.Bytes()
+
+	if !cmp.Equal(got, want) {
+		err := os.WriteFile("fail.gmi", got, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Fatal(cmp.Diff(got, want))
+	}
+}
+
+// TestConcurrent renders the same document from several goroutines with one
+// GemRenderer.
+func TestConcurrent(t *testing.T) {
+	src, want, err := setupFiles("test_data/footnote.md", "test_data/renderFootnoteDocument.gmi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := goldmark.New(
+		goldmark.WithExtensions(
+			wiki.Wiki,
+			extension.Linkify,
+			extension.Strikethrough,
+			extension.Table,
+			extension.Footnote,
+			extension.TaskList,
+			extension.DefinitionList,
+			FrontMatter,
+		),
+	)
+	md.SetRenderer(New(WithFootnote(FootnoteDocument)))
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			var buf bytes.Buffer
+			if err := md.Convert(src, &buf); err != nil {
+				errs <- err
+				return
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				errs <- fmt.Errorf("got:\n%s\nwant:\n%s", buf.Bytes(), want)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Error(err)
+	}
+}
+
+// TestConvertError checks that the state kept for a document is dropped when
+// rendering it fails.
+func TestConvertError(t *testing.T) {
+	config := NewConfig()
+	WithCodeBlockHandlers(map[string]CodeBlockHandler{
+		"go": func(w io.Writer, block CodeBlock) error {
+			return fmt.Errorf("failed")
+		},
+	}).SetConfig(config)
+	r := NewGemRenderer(config)
+	md := goldmark.New()
+	md.SetRenderer(renderer.NewRenderer(
+		renderer.WithNodeRenderers(util.Prioritized(r, 1000)),
+	))
+	for i := 0; i < 3; i++ {
+		var buf bytes.Buffer
+		if err := md.Convert([]byte("# Code\n\n```go\nfunc main() {}\n```\n"), &buf); err == nil {
+			t.Fatal("expected an error")
+		}
+	}
+	if n := len(r.documents); n != 0 {
+		t.Fatalf("%d documents are still kept after rendering", n)
+	}
+}
+
+// TestSplit splits a document into pages and compares each page to the file of
+// the same name in a test_data directory.
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		srcPath string
+		wantDir string
+		names   []string
+		option  Option
+	}{
+		{
+			"test_data/split.md", "test_data/split",
+			[]string{"index.gmi", "getting-started.gmi", "usage.gmi", "questions.gmi"},
+			WithTOC(TOCLinks),
+		},
+		{
+			"test_data/split.md", "test_data/splitLevel",
+			[]string{"index.gmi", "getting-started.gmi", "installing.gmi", "usage.gmi", "configuring.gmi", "questions.gmi"},
+			OptionFunc(func(c *Config) {
+				c.SplitLevel = 3
+				c.ParagraphLink = ParagraphLinkSection
+			}),
+		},
+		{
+			"test_data/split_index.md", "test_data/splitIndex",
+			[]string{"index.gmi", "index-1.gmi", "questions--answers.gmi"},
+			WithTOC(TOCOff),
+		},
+	}
+
+	for _, test := range tests {
+		src, err := os.ReadFile(test.srcPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		md := goldmark.New(
+			goldmark.WithExtensions(
+				wiki.Wiki,
+				extension.Linkify,
+				extension.Strikethrough,
+				extension.Table,
+				extension.Footnote,
+				extension.TaskList,
+				extension.DefinitionList,
+				FrontMatter,
+			),
+		)
+		doc := md.Parser().Parse(text.NewReader(src))
+
+		config := NewConfig()
+		test.option.SetConfig(config)
+		pages, err := NewGemRenderer(config).Split(src, doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var names []string
+		for _, page := range pages {
+			names = append(names, page.Name)
+		}
+		if !cmp.Equal(names, test.names) {
+			t.Fatal(cmp.Diff(names, test.names))
+		}
+		for _, page := range pages {
+			want, err := os.ReadFile(filepath.Join(test.wantDir, page.Name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !cmp.Equal(page.Content, want) {
+				err := os.WriteFile("fail.gmi", page.Content, 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+				t.Fatal(cmp.Diff(page.Content, want))
+			}
+		}
+	}
+}
+
+// TestWarn checks the warnings sent while rendering a document.
+func TestWarn(t *testing.T) {
+	src, err := os.ReadFile("test_data/codefence.md")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Warning
+	md := goldmark.New()
+	md.SetRenderer(New(WithWarn(func(w Warning) {
+		got = append(got, w)
+	})))
+	if err := md.Convert(src, io.Discard); err != nil {
+		t.Fatal(err)
+	}
+
+	message := "code block line begins with a preformatting toggle"
+	want := []Warning{{6, message}, {8, message}, {11, message}, {13, message}}
+	if !cmp.Equal(got, want) {
+		t.Fatal(cmp.Diff(got, want))
+	}
+}
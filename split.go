@@ -0,0 +1,155 @@
+package gemtext
+
+import (
+	"bufio"
+	"bytes"
+	"strconv"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+)
+
+// IndexPage is the name of the first page of a split document.
+const IndexPage = "index.gmi"
+
+// A Page is a gemtext page which was split from a document.
+type Page struct {
+	// Name is the page's file name. The first page is always named
+	// IndexPage and the rest are named after the id of the heading they begin
+	// with, numbered if the name is already taken.
+	Name string
+	// Title is the text of the page's first heading.
+	Title string
+	// Content is the rendered gemtext.
+	Content []byte
+}
+
+// Split renders a document as multiple pages, split at each heading in the
+// document's root up to the SplitLevel config option. The document's first
+// heading is not split, since it usually titles the whole document, so
+// everything before the first split is placed on an index page. The index page
+// links to every other page and each page links to the index and to the
+// previous and next pages. Links to headings, such as "#usage", are rewritten
+// to point to the page containing that heading.
+func (r *GemRenderer) Split(source []byte, doc ast.Node) ([]Page, error) {
+	defer r.end(doc)
+	return r.begin(doc).split(source, doc)
+}
+
+// split is Split using the copy of the renderer kept for doc.
+func (r *GemRenderer) split(source []byte, doc ast.Node) ([]Page, error) {
+	r.prepare(source, doc)
+	ids := r.headingIDs(source, doc)
+
+	// Find the first node on each page.
+	pages := []Page{{Name: IndexPage}}
+	used := map[string]bool{IndexPage: true}
+	starts := []ast.Node{doc.FirstChild()}
+	var first bool
+	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+		h, ok := n.(*ast.Heading)
+		if !ok || r.hidden[n] {
+			continue
+		}
+		if !first {
+			first = true
+			text, err := r.inlineText(source, h)
+			if err != nil {
+				return nil, err
+			}
+			pages[0].Title = string(text)
+			continue
+		}
+		if h.Level > r.config.SplitLevel {
+			continue
+		}
+		text, err := r.inlineText(source, h)
+		if err != nil {
+			return nil, err
+		}
+		name := ids[h]
+		if name == "" {
+			name = "page-" + strconv.Itoa(len(pages))
+		}
+		// Page names are kept unique and never replace the index page.
+		file := name + ".gmi"
+		for i := 1; used[file]; i++ {
+			file = name + "-" + strconv.Itoa(i) + ".gmi"
+		}
+		used[file] = true
+		pages = append(pages, Page{Name: file, Title: string(text)})
+		starts = append(starts, n)
+	}
+
+	// Point links to headings at the page containing each heading.
+	r.anchors = map[string]string{}
+	page := 0
+	for n := doc.FirstChild(); n != nil; n = n.NextSibling() {
+		if page+1 < len(starts) && n == starts[page+1] {
+			page++
+		}
+		_ = ast.Walk(n, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+			if id, ok := ids[node]; ok && entering {
+				r.anchors[id] = pages[page].Name
+			}
+			return ast.WalkContinue, nil
+		})
+	}
+
+	for i := range pages {
+		var buf bytes.Buffer
+		w := bufio.NewWriter(&buf)
+		var last ast.Node
+		for n := starts[i]; n != nil; n = n.NextSibling() {
+			if i+1 < len(starts) && n == starts[i+1] {
+				break
+			}
+			if err := r.render(w, source, n); err != nil {
+				return nil, err
+			}
+			last = n
+		}
+		// End the page's last heading section, unless the footnote list
+		// already did.
+		if last != nil && last.Kind() != east.KindFootnoteList {
+			if err := r.sectionEnd(w, source, last); err != nil {
+				return nil, err
+			}
+		}
+		if err := w.Flush(); err != nil {
+			return nil, err
+		}
+
+		content := bytes.TrimRight(buf.Bytes(), "\n")
+		if len(content) > 0 {
+			content = append(content, "\n\n"...)
+		}
+		var nav []link
+		if i == 0 {
+			for _, p := range pages[1:] {
+				nav = append(nav, link{p.Name, p.Title})
+			}
+		} else {
+			if i > 1 {
+				nav = append(nav, link{pages[i-1].Name, "Previous: " + pages[i-1].Title})
+			}
+			if i+1 < len(pages) {
+				nav = append(nav, link{pages[i+1].Name, "Next: " + pages[i+1].Title})
+			}
+			nav = append(nav, link{IndexPage, pages[0].Title})
+		}
+		out := bytes.NewBuffer(content)
+		linksPrint(out, nav)
+		pages[i].Content = out.Bytes()
+	}
+	return pages, nil
+}
+
+// anchor returns the destination of a link to the heading with the given id.
+// When a document is split into pages, it's the page containing the heading.
+func (r *GemRenderer) anchor(id string) string {
+	if page, ok := r.anchors[id]; ok {
+		return page
+	}
+	return "#" + id
+}
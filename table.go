@@ -0,0 +1,256 @@
+package gemtext
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/yuin/goldmark/ast"
+	east "github.com/yuin/goldmark/extension/ast"
+	"github.com/yuin/goldmark/util"
+)
+
+// table is a simplified copy of a markdown table with each cell already
+// rendered as plain text. It's used to measure and print the table.
+type table struct {
+	header []string
+	rows   [][]string
+	align  []east.Alignment
+
+	// caption is used as the alt text of the preformatted block instead of
+	// the header, if it's set.
+	caption string
+}
+
+// renderTable writes a table (per the github markdown extension) as either a
+// preformatted block or a list depending on the Table config option. Links
+// found in the table's cells are printed below it.
+func (r *GemRenderer) renderTable(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	n := node.(*east.Table)
+	if r.config.Table == TableOff {
+		return ast.WalkSkipChildren, nil
+	}
+	if entering {
+		t := table{align: n.Alignments}
+		t.caption, _ = r.attribute(n, "alt")
+		for row := n.FirstChild(); row != nil; row = row.NextSibling() {
+			if r.hidden[row] {
+				continue
+			}
+			var cells []string
+			for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+				text, err := r.inlineText(source, cell)
+				if err != nil {
+					return ast.WalkStop, err
+				}
+				cells = append(cells, string(text))
+			}
+			if row.Kind() == east.KindTableHeader {
+				t.header = cells
+			} else {
+				t.rows = append(t.rows, cells)
+			}
+		}
+
+		t.print(w, r.config)
+		return ast.WalkSkipChildren, nil
+	} else {
+		fmt.Fprintf(w, "\n\n")
+		switch r.config.ParagraphLink {
+		case ParagraphLinkOff, ParagraphLinkSection:
+			return ast.WalkContinue, nil
+		}
+
+		var format string
+		if r.config.ParagraphLink == ParagraphLinkCurlyBelow {
+			format = "{%s}"
+		}
+
+		// Print all links that were in the table's cells below the table.
+		var links []link
+		for row := n.FirstChild(); row != nil; row = row.NextSibling() {
+			if r.hidden[row] {
+				continue
+			}
+			for cell := row.FirstChild(); cell != nil; cell = cell.NextSibling() {
+				links = append(links, r.inlineLinks(source, cell, format, false)...)
+			}
+		}
+		if linksPrint(w, r.dedup(links)) {
+			fmt.Fprintf(w, "\n")
+		}
+	}
+	return ast.WalkContinue, nil
+}
+
+func (r *GemRenderer) renderTableHeader(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	// Nothing to do; handled by renderTable.
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *GemRenderer) renderTableRow(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	// Nothing to do; handled by renderTable.
+	return ast.WalkSkipChildren, nil
+}
+
+func (r *GemRenderer) renderTableCell(w util.BufWriter, source []byte, node ast.Node, entering bool) (ast.WalkStatus, error) {
+	// Nothing to do; handled by renderTable.
+	return ast.WalkSkipChildren, nil
+}
+
+// print writes the table as either a preformatted block or a list depending on
+// the Table config options.
+func (t table) print(w io.Writer, c Config) {
+	switch {
+	case c.Table == TableRowList:
+		t.writeRowList(w)
+	case c.TableWidth > 0 && t.width() > c.TableWidth:
+		// Too wide to be readable on small screens.
+		t.writeRowList(w)
+	default:
+		t.writePreformatted(w)
+	}
+}
+
+// columns returns the number of columns in the table.
+func (t table) columns() int {
+	cols := len(t.align)
+	if len(t.header) > cols {
+		cols = len(t.header)
+	}
+	for _, row := range t.rows {
+		if len(row) > cols {
+			cols = len(row)
+		}
+	}
+	return cols
+}
+
+// widths returns the width of each column measured in runes.
+func (t table) widths() []int {
+	widths := make([]int, t.columns())
+	measure := func(cells []string) {
+		for i, cell := range cells {
+			if l := utf8.RuneCountInString(cell); l > widths[i] {
+				widths[i] = l
+			}
+		}
+	}
+	measure(t.header)
+	for _, row := range t.rows {
+		measure(row)
+	}
+	return widths
+}
+
+// width returns the width of the table in characters when printed as a
+// preformatted block, including borders.
+func (t table) width() int {
+	width := 1
+	for _, w := range t.widths() {
+		width += w + 3
+	}
+	return width
+}
+
+// alt returns the alt text used for the table's preformatted block.
+func (t table) alt() string {
+	if t.caption != "" {
+		return t.caption
+	}
+	var names []string
+	for _, cell := range t.header {
+		if cell != "" {
+			names = append(names, cell)
+		}
+	}
+	if len(names) == 0 {
+		return "Table"
+	}
+	return "Table: " + strings.Join(names, ", ")
+}
+
+// writePreformatted writes the table as a preformatted block with ascii
+// borders. The closing ``` is not followed by a newline.
+func (t table) writePreformatted(w io.Writer) {
+	widths := t.widths()
+
+	border := func(fill string) {
+		fmt.Fprint(w, "+")
+		for _, width := range widths {
+			fmt.Fprintf(w, "%s+", strings.Repeat(fill, width+2))
+		}
+		fmt.Fprint(w, "\n")
+	}
+	row := func(cells []string) {
+		fmt.Fprint(w, "|")
+		for i, width := range widths {
+			var cell string
+			if i < len(cells) {
+				cell = cells[i]
+			}
+			var align east.Alignment
+			if i < len(t.align) {
+				align = t.align[i]
+			}
+			fmt.Fprintf(w, " %s |", pad(cell, width, align))
+		}
+		fmt.Fprint(w, "\n")
+	}
+
+	fmt.Fprintf(w, "```%s\n", t.alt())
+	border("-")
+	if t.header != nil {
+		row(t.header)
+		border("=")
+	}
+	for _, cells := range t.rows {
+		row(cells)
+	}
+	if len(t.rows) > 0 || t.header == nil {
+		border("-")
+	}
+	fmt.Fprint(w, "```")
+}
+
+// pad fills a cell with spaces up to width runes according to its alignment.
+func pad(s string, width int, align east.Alignment) string {
+	space := width - utf8.RuneCountInString(s)
+	if space <= 0 {
+		return s
+	}
+	switch align {
+	case east.AlignRight:
+		return strings.Repeat(" ", space) + s
+	case east.AlignCenter:
+		left := space / 2
+		return strings.Repeat(" ", left) + s + strings.Repeat(" ", space-left)
+	default:
+		return s + strings.Repeat(" ", space)
+	}
+}
+
+// writeRowList writes each row of the table as a list of "header: value"
+// items, separated by blank lines. Empty cells are left out. The last item is
+// not followed by a newline.
+func (t table) writeRowList(w io.Writer) {
+	var blocks []string
+	for _, cells := range t.rows {
+		var items []string
+		for i, cell := range cells {
+			if cell == "" {
+				continue
+			}
+			if i < len(t.header) && t.header[i] != "" {
+				items = append(items, "* "+t.header[i]+": "+cell)
+			} else {
+				items = append(items, "* "+cell)
+			}
+		}
+		if len(items) > 0 {
+			blocks = append(blocks, strings.Join(items, "\n"))
+		}
+	}
+	fmt.Fprint(w, strings.Join(blocks, "\n\n"))
+}
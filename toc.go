@@ -0,0 +1,118 @@
+package gemtext
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/util"
+)
+
+// tocPrint is a helper function that prints a table of contents, based on the
+// TOC config options, listing every heading after first in the document.
+func (r *GemRenderer) tocPrint(w util.BufWriter, source []byte, first *ast.Heading) error {
+	doc := first.OwnerDocument()
+	if doc == nil {
+		return nil
+	}
+	ids := r.headingIDs(source, doc)
+
+	var headings []*ast.Heading
+	minLevel := 0
+	err := ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		n, ok := node.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		if n == first || r.hidden[n] || r.config.TOCDepth > 0 && n.Level > r.config.TOCDepth {
+			return ast.WalkSkipChildren, nil
+		}
+		headings = append(headings, n)
+		if minLevel == 0 || n.Level < minLevel {
+			minLevel = n.Level
+		}
+		return ast.WalkSkipChildren, nil
+	})
+	if err != nil || len(headings) == 0 {
+		return err
+	}
+
+	if r.config.TOCLabel != "" {
+		fmt.Fprintf(w, "## %s", r.config.TOCLabel)
+		r.headingEnd(w)
+	}
+	for _, n := range headings {
+		text, err := r.inlineText(source, n)
+		if err != nil {
+			return err
+		}
+		switch r.config.TOC {
+		case TOCLinks:
+			fmt.Fprintf(w, "=> %s %s\n", r.anchor(ids[n]), text)
+		default:
+			indent := strings.Repeat("  ", n.Level-minLevel)
+			fmt.Fprintf(w, "%s* %s\n", indent, text)
+		}
+	}
+	fmt.Fprintf(w, "\n")
+	return nil
+}
+
+// headingIDs returns the id of every heading in a document. Headings use their
+// id attribute if they have one, otherwise an id is made from the last line
+// of their source, without any attribute list, just like goldmark's
+// parser.WithAutoHeadingID. Duplicate ids are numbered to keep them unique.
+func (r *GemRenderer) headingIDs(source []byte, doc ast.Node) map[ast.Node]string {
+	ids := map[ast.Node]string{}
+	seen := map[string]bool{}
+	_ = ast.Walk(doc, func(node ast.Node, entering bool) (ast.WalkStatus, error) {
+		n, ok := node.(*ast.Heading)
+		if !entering || !ok {
+			return ast.WalkContinue, nil
+		}
+		if id, ok := r.attribute(n, "id"); ok && id != "" {
+			seen[id] = true
+			ids[n] = id
+			return ast.WalkSkipChildren, nil
+		}
+		var text []byte
+		if lines := n.Lines(); lines.Len() > 0 {
+			line := lines.At(lines.Len() - 1)
+			if start, ok := r.attributeStarts[n]; ok {
+				line.Stop = start
+			}
+			text = line.Value(source)
+		}
+		id := slug(string(text))
+		for i := 1; seen[id]; i++ {
+			id = slug(string(text)) + "-" + strconv.Itoa(i)
+		}
+		seen[id] = true
+		ids[n] = id
+		return ast.WalkSkipChildren, nil
+	})
+	return ids
+}
+
+// slug returns a lowercase version of s, suitable for use as an id. It matches
+// the ids made by goldmark: ASCII letters and numbers are kept, each space,
+// hyphen, or underscore becomes a hyphen, and everything else is removed.
+func slug(s string) string {
+	var b strings.Builder
+	for _, c := range strings.TrimSpace(s) {
+		switch {
+		case c >= 'a' && c <= 'z' || c >= '0' && c <= '9':
+			b.WriteRune(c)
+		case c >= 'A' && c <= 'Z':
+			b.WriteRune(unicode.ToLower(c))
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '-' || c == '_':
+			b.WriteByte('-')
+		}
+	}
+	if b.Len() == 0 {
+		return "heading"
+	}
+	return b.String()
+}